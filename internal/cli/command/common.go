@@ -1,8 +1,71 @@
 package command
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/XanderKon/sql-migrator-otus/internal/logger"
+	"github.com/XanderKon/sql-migrator-otus/pkg/core"
+)
+
+var (
+	ErrMissingVersion = errors.New("no migration version was set")
+	ErrWrongVersion   = errors.New("wrong migration version")
+	ErrWrongSteps     = errors.New("wrong number of steps")
+)
+
 // Common interface for all available cli commands.
 type Command interface {
 	// Main command
+	// ctx — canceled on timeout or SIGINT/SIGTERM
 	// args — all arguments from cmd except just first
-	Run(args []string) error
+	Run(ctx context.Context, args []string) error
+}
+
+// get target version from first argument.
+func parseVersion(args []string) (int64, error) {
+	if len(args) == 0 {
+		return -1, ErrMissingVersion
+	}
+
+	version, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || version < 0 {
+		return -1, fmt.Errorf("%w: %s", ErrWrongVersion, args[0])
+	}
+
+	return version, nil
+}
+
+// get number of steps from first argument (defaultSteps if not set).
+func parseSteps(args []string, defaultSteps int) (int, error) {
+	if len(args) == 0 {
+		return defaultSteps, nil
+	}
+
+	steps, err := strconv.Atoi(args[0])
+	if err != nil || steps <= 0 {
+		return 0, fmt.Errorf("%w: %s", ErrWrongSteps, args[0])
+	}
+
+	return steps, nil
+}
+
+// print summary of executed migrations.
+func printResult(log *logger.Logger, result *core.Result) {
+	if log == nil || result == nil || len(result.Migrations) == 0 {
+		return
+	}
+
+	for _, res := range result.Migrations {
+		status := "OK"
+		if !res.Succeeded() {
+			status = "FAILED"
+		}
+
+		log.Info("%s %d (%s): %s in %s", res.Direction, res.Version, res.Source, status, res.Duration)
+	}
+
+	log.Info("Executed %d migration(s) in %s", len(result.Migrations), result.Duration())
 }
@@ -0,0 +1,42 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersion(t *testing.T) {
+	version, err := parseVersion([]string{"1706128932160"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1706128932160), version)
+
+	version, err = parseVersion([]string{"0"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), version)
+
+	_, err = parseVersion([]string{})
+	assert.ErrorIs(t, err, ErrMissingVersion)
+
+	_, err = parseVersion([]string{"-1"})
+	assert.ErrorIs(t, err, ErrWrongVersion)
+
+	_, err = parseVersion([]string{"latest"})
+	assert.ErrorIs(t, err, ErrWrongVersion)
+}
+
+func TestParseSteps(t *testing.T) {
+	steps, err := parseSteps([]string{}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, steps)
+
+	steps, err = parseSteps([]string{"3"}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, steps)
+
+	_, err = parseSteps([]string{"0"}, 1)
+	assert.ErrorIs(t, err, ErrWrongSteps)
+
+	_, err = parseSteps([]string{"two"}, 1)
+	assert.ErrorIs(t, err, ErrWrongSteps)
+}
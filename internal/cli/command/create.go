@@ -1,6 +1,7 @@
 package command
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"html/template"
@@ -24,7 +25,7 @@ type Create struct {
 	Logger *logger.Logger
 }
 
-func (c *Create) Run(args []string) error {
+func (c *Create) Run(_ context.Context, args []string) error {
 	if len(args) == 0 {
 		return ErrMissingName
 	}
@@ -117,8 +118,14 @@ var goMigrationTemplate = template.Must(template.New("gomigrator.go-migration").
 import (
 	"context"
 	"database/sql"
+
+	"github.com/XanderKon/sql-migrator-otus/pkg/core"
 )
 
+func init() {
+	core.AddMigration(Up_{{.Name}}, Down_{{.Name}})
+}
+
 func Up_{{.Name}}(ctx context.Context, tx *sql.Tx) error {
 	// This code is executed when the migration is applied.
 	return nil
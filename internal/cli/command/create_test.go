@@ -2,8 +2,11 @@ package command
 
 import (
 	"fmt"
+	"go/parser"
+	"go/token"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -79,3 +82,33 @@ func TestCreate(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateGoMigrationCompiles(t *testing.T) {
+	cmd := &Create{
+		Cfg:    &config.MigratorConf{Dir: t.TempDir(), Type: "go"},
+		Logger: logger.New("DEBUG", io.Discard),
+	}
+
+	if err := cmd.create("TestMigration"); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(cmd.Cfg.Dir, "*.go"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one created file, but received: %v (%v)", files, err)
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), files[0], nil, parser.AllErrors)
+	if err != nil {
+		t.Fatalf("Generated migration isn't valid Go code: %v", err)
+	}
+
+	// the parser doesn't complain about duplicate imports, but the compiler does
+	imports := make(map[string]bool)
+	for _, spec := range file.Imports {
+		if imports[spec.Path.Value] {
+			t.Errorf("Error: %s is imported twice", spec.Path.Value)
+		}
+		imports[spec.Path.Value] = true
+	}
+}
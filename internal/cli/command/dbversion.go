@@ -1,6 +1,7 @@
 package command
 
 import (
+	"context"
 	"errors"
 
 	"github.com/XanderKon/sql-migrator-otus/internal/logger"
@@ -12,8 +13,8 @@ type Dbversion struct {
 	Logger   *logger.Logger
 }
 
-func (c *Dbversion) Run(_ []string) error {
-	_, err := c.Migrator.Dbversion()
+func (c *Dbversion) Run(ctx context.Context, _ []string) error {
+	_, err := c.Migrator.DbversionContext(ctx)
 
 	if errors.Is(err, core.ErrNoCurrentVersion) {
 		c.Logger.Info(err.Error())
@@ -1,6 +1,8 @@
 package command
 
 import (
+	"context"
+
 	"github.com/XanderKon/sql-migrator-otus/internal/logger"
 	"github.com/XanderKon/sql-migrator-otus/pkg/core"
 )
@@ -10,6 +12,14 @@ type Down struct {
 	Logger   *logger.Logger
 }
 
-func (c *Down) Run(_ []string) error {
-	return c.Migrator.Down()
+func (c *Down) Run(ctx context.Context, args []string) error {
+	steps, err := parseSteps(args, 1)
+	if err != nil {
+		return err
+	}
+
+	result, err := c.Migrator.StepsContext(ctx, -steps)
+	printResult(c.Logger, result)
+
+	return err
 }
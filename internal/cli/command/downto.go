@@ -0,0 +1,25 @@
+package command
+
+import (
+	"context"
+
+	"github.com/XanderKon/sql-migrator-otus/internal/logger"
+	"github.com/XanderKon/sql-migrator-otus/pkg/core"
+)
+
+type DownTo struct {
+	Migrator *core.Migrate
+	Logger   *logger.Logger
+}
+
+func (c *DownTo) Run(ctx context.Context, args []string) error {
+	version, err := parseVersion(args)
+	if err != nil {
+		return err
+	}
+
+	result, err := c.Migrator.DownToContext(ctx, version)
+	printResult(c.Logger, result)
+
+	return err
+}
@@ -1,6 +1,8 @@
 package command
 
 import (
+	"context"
+
 	"github.com/XanderKon/sql-migrator-otus/internal/logger"
 	"github.com/XanderKon/sql-migrator-otus/pkg/core"
 )
@@ -10,6 +12,9 @@ type Redo struct {
 	Logger   *logger.Logger
 }
 
-func (c *Redo) Run(_ []string) error {
-	return c.Migrator.Redo()
+func (c *Redo) Run(ctx context.Context, _ []string) error {
+	result, err := c.Migrator.RedoContext(ctx)
+	printResult(c.Logger, result)
+
+	return err
 }
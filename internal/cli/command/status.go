@@ -1,8 +1,10 @@
 package command
 
 import (
+	"context"
 	"errors"
 	"os"
+	"time"
 
 	"github.com/XanderKon/sql-migrator-otus/pkg/core"
 	"github.com/jedib0t/go-pretty/v6/table"
@@ -14,19 +16,30 @@ type Status struct {
 	Migrator *core.Migrate
 }
 
-func (c *Status) Run(_ []string) error {
-	migrations, err := c.Migrator.FullList()
+func (c *Status) Run(ctx context.Context, _ []string) error {
+	migrations, err := c.Migrator.FullListContext(ctx)
 	if err != nil {
 		return ErrGeneralError
 	}
 
 	t := table.NewWriter()
 	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"#", "Version", "Name", "Applied At"})
+	t.AppendHeader(table.Row{"#", "Version", "Name", "State", "Updated At", "Duration", "Last Error"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Name: "Last Error", WidthMax: 60},
+	})
 
 	for i, migr := range migrations {
 		t.AppendRows([]table.Row{
-			{i + 1, migr.Version, migr.Source, migr.AppliedAt.Format("2006-01-02 15:04:05")},
+			{
+				i + 1,
+				migr.Version,
+				migr.Source,
+				migr.State,
+				formatTime(migr.UpdatedAt()),
+				formatDuration(migr.Duration),
+				migr.LastError,
+			},
 		})
 	}
 
@@ -36,3 +49,21 @@ func (c *Status) Run(_ []string) error {
 
 	return nil
 }
+
+// empty string for zero time.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// empty string for zero duration.
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+
+	return d.Round(time.Millisecond).String()
+}
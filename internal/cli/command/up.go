@@ -1,6 +1,8 @@
 package command
 
 import (
+	"context"
+
 	"github.com/XanderKon/sql-migrator-otus/internal/logger"
 	"github.com/XanderKon/sql-migrator-otus/pkg/core"
 )
@@ -10,6 +12,21 @@ type Up struct {
 	Logger   *logger.Logger
 }
 
-func (c *Up) Run(_ []string) error {
-	return c.Migrator.Up()
+func (c *Up) Run(ctx context.Context, args []string) error {
+	// apply everything by default
+	steps, err := parseSteps(args, 0)
+	if err != nil {
+		return err
+	}
+
+	var result *core.Result
+	if steps == 0 {
+		result, err = c.Migrator.UpContext(ctx)
+	} else {
+		result, err = c.Migrator.StepsContext(ctx, steps)
+	}
+
+	printResult(c.Logger, result)
+
+	return err
 }
@@ -0,0 +1,32 @@
+package command
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/XanderKon/sql-migrator-otus/internal/logger"
+	"github.com/XanderKon/sql-migrator-otus/pkg/core"
+)
+
+type Verify struct {
+	Migrator *core.Migrate
+	Logger   *logger.Logger
+}
+
+func (c *Verify) Run(ctx context.Context, _ []string) error {
+	changed, err := c.Migrator.VerifyContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(changed) == 0 {
+		c.Logger.Info("All applied migrations match their files")
+		return nil
+	}
+
+	for _, migr := range changed {
+		c.Logger.Warning("Migration %d (%s) was changed after applying", migr.Version, migr.Source)
+	}
+
+	return fmt.Errorf("%w: %d migration(s)", core.ErrChecksumMismatch, len(changed))
+}
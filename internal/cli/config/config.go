@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -14,10 +15,19 @@ type Config struct {
 }
 
 type MigratorConf struct {
-	DSN       string `mapstructure:"dsn"`
-	Dir       string `mapstructure:"dir"`
-	Type      string `mapstructure:"type"`
-	TableName string `mapstructure:"table_name"`
+	DSN             string        `mapstructure:"dsn"`
+	Dir             string        `mapstructure:"dir"`
+	Type            string        `mapstructure:"type"`
+	TableName       string        `mapstructure:"table_name"`
+	Schema          string        `mapstructure:"schema"`
+	SearchPath      bool          `mapstructure:"search_path"`
+	DryRun          bool          `mapstructure:"dry_run"`
+	AllowMissing    bool          `mapstructure:"allow_missing"`
+	IgnoreChecksums bool          `mapstructure:"ignore_checksums"`
+	Atomic          bool          `mapstructure:"atomic"`
+	LockTimeout     time.Duration `mapstructure:"lock_timeout"`
+	LockID          int64         `mapstructure:"lock_id"`
+	Timeout         time.Duration `mapstructure:"timeout"`
 }
 
 type LoggerConf struct {
@@ -25,10 +35,19 @@ type LoggerConf struct {
 }
 
 var (
-	configFile string
-	dsn        string
-	dir        string
-	tableName  string
+	configFile      string
+	dsn             string
+	dir             string
+	tableName       string
+	schema          string
+	searchPath      bool
+	dryRun          bool
+	allowMissing    bool
+	ignoreChecksums bool
+	atomic          bool
+	lockTimeout     time.Duration
+	lockID          int64
+	timeout         time.Duration
 )
 
 func initFlag() {
@@ -36,6 +55,17 @@ func initFlag() {
 	flag.StringVar(&dsn, "dsn", "", "Database string connection")
 	flag.StringVar(&dir, "dir", "./migrations", "Path to migration folder")
 	flag.StringVar(&tableName, "tableName", "migrations", "Name of migrations table")
+	flag.StringVar(&schema, "schema", "", "Schema of migrations table (created if missing)")
+	flag.BoolVar(&searchPath, "search-path", false, "Run migrations with search_path set to schema")
+	flag.BoolVar(&dryRun, "dry-run", false, "Print migrations without executing them")
+	flag.BoolVar(&allowMissing, "allow-missing", false, "Apply not applied migrations older than the current version")
+	flag.BoolVar(&ignoreChecksums, "ignore-checksums", false,
+		"Do not refuse to migrate if applied migrations were changed")
+	flag.BoolVar(&atomic, "atomic", false, "Run all selected migrations in a single transaction")
+	flag.DurationVar(&lockTimeout, "lock-timeout", 0,
+		"How long to wait for the lock held by another process (e.g. 1m, fail immediately by default)")
+	flag.Int64Var(&lockID, "lock-id", 0, "Key of migrations lock (derived from DB and table name by default)")
+	flag.DurationVar(&timeout, "timeout", 0, "Timeout of command execution (e.g. 5m, without timeout by default)")
 
 	flag.Parse()
 }
@@ -79,6 +109,43 @@ func NewConfig() *Config {
 		}
 	}
 
+	// flag has priority over file
+	if schema != "" {
+		config.Migrator.Schema = schema
+	}
+
+	if searchPath {
+		config.Migrator.SearchPath = true
+	}
+
+	if dryRun {
+		config.Migrator.DryRun = true
+	}
+
+	if allowMissing {
+		config.Migrator.AllowMissing = true
+	}
+
+	if ignoreChecksums {
+		config.Migrator.IgnoreChecksums = true
+	}
+
+	if atomic {
+		config.Migrator.Atomic = true
+	}
+
+	if lockTimeout > 0 {
+		config.Migrator.LockTimeout = lockTimeout
+	}
+
+	if lockID != 0 {
+		config.Migrator.LockID = lockID
+	}
+
+	if timeout > 0 {
+		config.Migrator.Timeout = timeout
+	}
+
 	if config.Migrator.DSN == "" {
 		fmt.Printf("[ERROR] Wrong configuration of app. Cannot get a DSN setting!\n")
 		os.Exit(1)
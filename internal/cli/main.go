@@ -1,10 +1,13 @@
 package cli
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/XanderKon/sql-migrator-otus/internal/cli/command"
 	"github.com/XanderKon/sql-migrator-otus/internal/cli/config"
@@ -21,20 +24,33 @@ func initFlags() {
   You can override varuables from config file by ENV, just use something like "${DB_DSN}"
 
   OPTIONS:
-    -config         Path to configuration file (no default value)
-    -dsn            DSN string to database
-    -dir            Folder for migrations files ("./migrations" by default)
-    -tableName      Name of migrations table ("migrations" by default)	
+    -config             Path to configuration file (no default value)
+    -dsn                DSN string to database
+    -dir                Folder for migrations files ("./migrations" by default)
+    -tableName          Name of migrations table ("migrations" by default)
+    -schema             Schema of migrations table, created if missing (current schema by default)
+    -search-path        Run migrations with search_path set to the schema
+    -dry-run            Print migrations which would be executed without running them
+    -allow-missing      Apply pending migrations older than the current DB version
+    -ignore-checksums   Do not refuse to migrate if applied migrations were changed
+    -atomic             Run all selected migrations in a single transaction (all or nothing)
+    -lock-timeout       How long to wait for the lock held by another process, e.g. "1m" (fail immediately by default)
+    -lock-id            Key of migrations lock (derived from DB, schema and table name by default)
+    -timeout            Timeout of command execution, e.g. "5m" (no timeout by default)
 		
   COMMAND:
-    create [name]   Create migration with 'name'
-    up              Migrate the DB to the most recent version available
-    down            Roll back the version by 1
-    redo            Re-run the latest migration
-    status          Print all migrations status
-    dbversion       Print migrations status (last applied migration)
-    help            Print usage
-    version         Application version
+    create [name]       Create migration with 'name'
+    up [N]              Migrate the DB to the most recent version available (or apply N migrations)
+    up-to [version]     Migrate the DB up to a specific version
+    down [N]            Roll back the version by 1 (or by N)
+    down-to [version]   Roll back the DB down to a specific version (0 to roll back all)
+    goto [version]      Migrate the DB to a specific version in any direction
+    redo                Re-run the latest migration
+    status              Print all migrations status
+    verify              Check that applied migrations were not changed
+    dbversion           Print migrations status (last applied migration)
+    help                Print usage
+    version             Application version
 
   Examples:
     gomigrator -config="../configs/config-test.yml" create "create_user_table"
@@ -69,14 +85,33 @@ func Main() {
 	var cmd command.Command
 
 	// init migrate api
-	migrator, err := core.NewMigrator(cfg.Migrator.DSN, cfg.Migrator.TableName, cfg.Migrator.Dir)
+	migrator, err := core.New(
+		core.WithDSN(cfg.Migrator.DSN),
+		core.WithTableName(cfg.Migrator.TableName),
+		core.WithSchema(cfg.Migrator.Schema),
+		core.WithSearchPath(cfg.Migrator.SearchPath),
+		core.WithDir(cfg.Migrator.Dir),
+		// just print migrations without running (and without creating migrations table)
+		core.WithDryRun(cfg.Migrator.DryRun),
+		// wait for another replica instead of failing
+		core.WithLockTimeout(cfg.Migrator.LockTimeout),
+		core.WithLockID(cfg.Migrator.LockID),
+		// also receives NOTICE messages of DB server
+		core.WithLogger(logger),
+	)
 	if err != nil {
 		logger.Error("[ERROR] Can't initialize migrator api! %s", err)
 		return
 	}
 
-	// add logger
-	migrator.Log = logger
+	// apply "holes" in history instead of failing
+	migrator.AllowMissing = cfg.Migrator.AllowMissing
+
+	// just warn about changed migrations
+	migrator.IgnoreChecksums = cfg.Migrator.IgnoreChecksums
+
+	// all or nothing
+	migrator.Atomic = cfg.Migrator.Atomic
 
 	// close migrator (DB connection in simple case)
 	defer migrator.Close()
@@ -92,16 +127,36 @@ func Main() {
 			Migrator: migrator,
 			Logger:   logger,
 		}
+	case "up-to":
+		cmd = &command.UpTo{
+			Migrator: migrator,
+			Logger:   logger,
+		}
 	case "down":
 		cmd = &command.Down{
 			Migrator: migrator,
 			Logger:   logger,
 		}
+	case "down-to":
+		cmd = &command.DownTo{
+			Migrator: migrator,
+			Logger:   logger,
+		}
+	case "goto":
+		cmd = &command.Goto{
+			Migrator: migrator,
+			Logger:   logger,
+		}
 	case "redo":
 		cmd = &command.Redo{
 			Migrator: migrator,
 			Logger:   logger,
 		}
+	case "verify":
+		cmd = &command.Verify{
+			Migrator: migrator,
+			Logger:   logger,
+		}
 	case "dbversion":
 		cmd = &command.Dbversion{
 			Migrator: migrator,
@@ -115,7 +170,18 @@ func Main() {
 		printUsage()
 	}
 
-	err = cmd.Run(args[2:])
+	// cancel command on SIGINT/SIGTERM or timeout
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.Migrator.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Migrator.Timeout)
+		defer cancel()
+	}
+
+	// pass all arguments after command name
+	err = cmd.Run(ctx, flag.Args()[1:])
 	if errors.Is(err, core.ErrAlreadyUpToDate) || errors.Is(err, core.ErrNoAvailableMigrations) {
 		logger.Info(err.Error())
 	} else if err != nil {
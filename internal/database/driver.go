@@ -1,8 +1,9 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
-	"io"
 	"strings"
 	"sync"
 	"time"
@@ -13,6 +14,9 @@ var (
 	ErrUnknownDriver = fmt.Errorf("unknown driver")
 	ErrLocked        = fmt.Errorf("can't acquire lock")
 	ErrUnlock        = fmt.Errorf("can't unlock, as not currently locked")
+
+	ErrNoInstanceSupport = fmt.Errorf("driver doesn't support existing connections")
+	ErrNoTransaction     = fmt.Errorf("migration can't be executed without transaction")
 )
 
 var driversMu sync.RWMutex
@@ -21,16 +25,118 @@ var driversMu sync.RWMutex
 // [JUST POSTGRES IN OUR PROJECT CASE].
 var drivers = make(map[string]Driver)
 
+// State of migration stored in migrations table.
+type State string
+
+const (
+	// Migration is running right now (or process was killed while running it).
+	StateApplying State = "applying"
+	// Migration was successfully applied.
+	StateApplied State = "applied"
+	// Migration failed, see LastError.
+	StateError State = "error"
+)
+
+// Config of driver instance.
+type Config struct {
+	// Name of migrations table (may be prefixed by schema, e.g. "app.migrations")
+	TableName string
+
+	// Schema of migrations table, it's created if missing (empty -- the current one)
+	Schema string
+
+	// Execute migrations with search_path set to Schema
+	// (e.g. to keep a set of migrations per tenant schema)
+	SearchPath bool
+
+	// Key of migrations lock. If it's 0, the key is derived by driver from
+	// DB name and table name, so different migration sets don't block each other.
+	LockID int64
+
+	// Receives messages sent by DB server while running migrations
+	// (e.g. NOTICE of PostgreSQL), may be nil. Only connections opened by
+	// driver from DSN are hooked up (pgx:// for PostgreSQL), messages of
+	// connections passed to WithInstance are handled by their owner.
+	Log Logger
+}
+
+// Logger is used by drivers to report messages of DB server.
+type Logger interface {
+	Info(msg string, params ...any)
+	Warning(msg string, params ...any)
+}
+
+// Row of migrations table.
 type ListInfo struct {
-	Version   int64
-	AppliedAt time.Time
+	Version    int64
+	Name       string
+	State      State
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Duration   time.Duration
+	LastError  string
+	AppliedAt  time.Time
+	Checksum   string
+}
+
+// Statement is a single SQL statement of migration.
+type Statement struct {
+	SQL string
+
+	// Line number in migration file (for error messages)
+	Line int
+
+	// Data of "COPY ... FROM STDIN" statement (nil for other statements).
+	// It's sent only through pgx connections, other drivers and connections
+	// of lib/pq fail with the statement.
+	CopyData []byte
+}
+
+// StatementError adds position of failed statement to err.
+func StatementError(statement Statement, err error) error {
+	return fmt.Errorf("statement at line %d: %w", statement.Line, err)
+}
+
+// Finish sets time when the run was finished and its duration
+// (and AppliedAt for applied migration). Drivers call it right before saving the row.
+func (info *ListInfo) Finish() {
+	info.FinishedAt = time.Now()
+	info.Duration = info.FinishedAt.Sub(info.StartedAt)
+
+	if info.State == StateApplied {
+		info.AppliedAt = info.FinishedAt
+	}
 }
 
+// TxFunc is a piece of Go code executed inside a transaction (used by Go-migrations).
+type TxFunc func(ctx context.Context, tx *sql.Tx) error
+
+// Migration is a unit of work for Driver.Run.
+type Migration struct {
+	Version int64
+
+	// SQL statements (for SQL-migrations)
+	Statements []Statement
+
+	// Go code (for Go-migrations)
+	Func TxFunc
+
+	// Execute statements outside of transaction (ignored for Func)
+	NoTransaction bool
+
+	// Row saved to migrations table right after successful run.
+	// If Record is nil, Version is deleted from migrations table (migration is rolled back).
+	Record *ListInfo
+}
+
+// Driver is an interface of DB driver for migrator.
+// All methods (except Open and Close) receive context of the current
+// operation and must stop as soon as it is canceled.
 type Driver interface {
 	// Open returns a new driver instance configured with parameters
 	// coming from the URL string. Migrate will call this function
 	// only once per instance.
-	Open(url string, tableName string) (Driver, error)
+	Open(url string, cfg Config) (Driver, error)
 
 	// Close closes the underlying database instance managed by the driver.
 	// Migrate will call this function only once per instance.
@@ -40,33 +146,45 @@ type Driver interface {
 	// can run at a time. Migrate will call this function before Run is called.
 	// If the implementation can't provide this functionality, return nil.
 	// Return database.ErrLocked if database is already locked.
-	Lock() error
+	Lock(ctx context.Context) error
 
 	// Unlock should release the lock. Migrate will call this function after
 	// all migrations have been run.
-	Unlock() error
+	Unlock(ctx context.Context) error
 
-	// Run applies a migration to the database. migration is guaranteed to be not nil.
-	Run(migration io.Reader) error
+	// Run executes migrations one by one (Func or Statements, use StatementError
+	// for errors) and saves their Records (or deletes Versions) atomically: inside
+	// a single transaction which is committed only if everything succeeded.
+	// If the only passed migration has NoTransaction set, its statements are
+	// executed without transaction and Record is saved after the last of them.
+	// Several migrations with NoTransaction can't be run together (ErrNoTransaction).
+	Run(ctx context.Context, migrations ...*Migration) error
 
-	// SetVersion saves version.
-	// Migrate will call this function before and after each call to Run.
-	SetVersion(version int64) error
+	// SetVersion saves state of migration (inserts or updates row by info.Version).
+	// Migrate will call this function before Run and after failed Run.
+	SetVersion(ctx context.Context, info *ListInfo) error
 
 	// DeleteVersion removes version.
-	// Migrate will call this function before and after each call to Run.
-	DeleteVersion(version int64) error
+	DeleteVersion(ctx context.Context, version int64) error
 
-	// Version returns the currently active version.
+	// Version returns the currently active version (the latest one in StateApplied).
 	// When no migration has been applied, it must return version -1.
-	Version() (version int64, err error)
+	Version(ctx context.Context) (version int64, err error)
 
-	// List returns the slice of all apllied versions of migraions.
-	// When no migration has been applied, it must return empty slice.
-	List() (versions []*ListInfo, err error)
+	// List returns the slice of all saved versions of migraions in any state.
+	// When no migration has been saved, it must return empty slice.
+	List(ctx context.Context) (versions []*ListInfo, err error)
 
 	// PrepareTable just create table
-	PrepareTable() error
+	PrepareTable(ctx context.Context) error
+}
+
+// InstanceDriver is implemented by drivers which can work
+// with already opened connection pool.
+type InstanceDriver interface {
+	// WithInstance returns a new driver instance for db.
+	// The driver must not close db in Close.
+	WithInstance(db *sql.DB, cfg Config) (Driver, error)
 }
 
 // Register globally registers a driver.
@@ -86,7 +204,7 @@ func Register(name string, driver Driver) {
 }
 
 // Open returns a new driver instance.
-func Open(url string, tableName string) (Driver, error) {
+func Open(url string, cfg Config) (Driver, error) {
 	i := strings.Index(url, ":")
 
 	if i < 0 {
@@ -102,5 +220,22 @@ func Open(url string, tableName string) (Driver, error) {
 		return nil, ErrUnknownDriver
 	}
 
-	return d.Open(url, tableName)
+	return d.Open(url, cfg)
+}
+
+// OpenWithInstance returns a new driver instance for already opened db.
+func OpenWithInstance(name string, db *sql.DB, cfg Config) (Driver, error) {
+	driversMu.RLock()
+	d, ok := drivers[name]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownDriver
+	}
+
+	instanceDriver, ok := d.(InstanceDriver)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoInstanceSupport, name)
+	}
+
+	return instanceDriver.WithInstance(db, cfg)
 }
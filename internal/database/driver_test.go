@@ -1,7 +1,9 @@
 package database
 
 import (
-	"io"
+	"context"
+	"database/sql"
+	"errors"
 	"testing"
 )
 
@@ -10,10 +12,17 @@ type testDriver struct {
 	tablename string
 }
 
-func (t *testDriver) Open(url string, tablename string) (Driver, error) {
+func (t *testDriver) Open(url string, cfg Config) (Driver, error) {
 	return &testDriver{
 		url:       url,
-		tablename: tablename,
+		tablename: cfg.TableName,
+	}, nil
+}
+
+func (t *testDriver) WithInstance(_ *sql.DB, cfg Config) (Driver, error) {
+	return &testDriver{
+		url:       "instance",
+		tablename: cfg.TableName,
 	}, nil
 }
 
@@ -21,35 +30,35 @@ func (t *testDriver) Close() error {
 	return nil
 }
 
-func (t *testDriver) Lock() error {
+func (t *testDriver) Lock(_ context.Context) error {
 	return nil
 }
 
-func (t *testDriver) Unlock() error {
+func (t *testDriver) Unlock(_ context.Context) error {
 	return nil
 }
 
-func (t *testDriver) Run(_ io.Reader) error {
+func (t *testDriver) Run(_ context.Context, _ ...*Migration) error {
 	return nil
 }
 
-func (t *testDriver) SetVersion(_ int64) error {
+func (t *testDriver) SetVersion(_ context.Context, _ *ListInfo) error {
 	return nil
 }
 
-func (t *testDriver) DeleteVersion(_ int64) error {
+func (t *testDriver) DeleteVersion(_ context.Context, _ int64) error {
 	return nil
 }
 
-func (t *testDriver) Version() (_ int64, err error) {
+func (t *testDriver) Version(_ context.Context) (_ int64, err error) {
 	return 0, nil
 }
 
-func (t *testDriver) List() (_ []*ListInfo, err error) {
+func (t *testDriver) List(_ context.Context) (_ []*ListInfo, err error) {
 	return make([]*ListInfo, 0), nil
 }
 
-func (t *testDriver) PrepareTable() error {
+func (t *testDriver) PrepareTable(_ context.Context) error {
 	return nil
 }
 
@@ -80,7 +89,7 @@ func TestOpen(t *testing.T) {
 
 	for _, c := range cases {
 		t.Run(c.url, func(t *testing.T) {
-			d, err := Open(c.url, "migrations")
+			d, err := Open(c.url, Config{TableName: "migrations"})
 
 			if err == nil && c.err {
 				t.Fatal("should be error for wrong driver")
@@ -100,3 +109,25 @@ func TestOpen(t *testing.T) {
 		})
 	}
 }
+
+func TestOpenWithInstance(t *testing.T) {
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		Register("test", &testDriver{})
+	}()
+
+	d, err := OpenWithInstance("test", &sql.DB{}, Config{TableName: "migrations"})
+	if err != nil {
+		t.Fatalf("did not expect %q", err)
+	}
+
+	if md, ok := d.(*testDriver); !ok || md.url != "instance" || md.tablename != "migrations" {
+		t.Fatalf("unexpected driver %#v", d)
+	}
+
+	if _, err := OpenWithInstance("unknown", &sql.DB{}, Config{TableName: "migrations"}); !errors.Is(err, ErrUnknownDriver) {
+		t.Fatalf("expected %q got %q", ErrUnknownDriver, err)
+	}
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LockHolder is implemented by drivers which can tell who holds the migrations lock.
+// Migrate uses it to report the holder when the lock can't be acquired.
+type LockHolder interface {
+	// LockHolder returns information about session holding the lock
+	// (nil if the lock is free or the holder is unknown).
+	LockHolder(ctx context.Context) (*LockInfo, error)
+}
+
+// LockInfo describes session holding the lock.
+type LockInfo struct {
+	PID         int64
+	Application string
+	ClientAddr  string
+	State       string
+
+	// Time when session was started
+	Since time.Time
+}
+
+func (i *LockInfo) String() string {
+	details := make([]string, 0, 4)
+	if i.Application != "" {
+		details = append(details, fmt.Sprintf("application %q", i.Application))
+	}
+
+	if i.ClientAddr != "" {
+		details = append(details, "client "+i.ClientAddr)
+	}
+
+	if i.State != "" {
+		details = append(details, "state "+i.State)
+	}
+
+	if !i.Since.IsZero() {
+		details = append(details, "since "+i.Since.Format(time.RFC3339))
+	}
+
+	if len(details) == 0 {
+		return fmt.Sprintf("pid %d", i.PID)
+	}
+
+	return fmt.Sprintf("pid %d (%s)", i.PID, strings.Join(details, ", "))
+}
@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/XanderKon/sql-migrator-otus/internal/database"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Info(msg string, params ...any) {
+	l.messages = append(l.messages, "INFO "+fmt.Sprintf(msg, params...))
+}
+
+func (l *recordingLogger) Warning(msg string, params ...any) {
+	l.messages = append(l.messages, "WARNING "+fmt.Sprintf(msg, params...))
+}
+
+func TestPgxConfig(t *testing.T) {
+	config, err := pgxConfig("pgx://app:secret@db:5433/app?sslmode=disable&application_name=deploy", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "db", config.Host)
+	assert.Equal(t, uint16(5433), config.Port)
+	assert.Equal(t, "app", config.User)
+	assert.Equal(t, "secret", config.Password)
+	assert.Equal(t, "app", config.Database)
+	assert.Equal(t, "deploy", config.RuntimeParams["application_name"])
+	assert.Nil(t, config.OnNotice)
+
+	config, err = pgxConfig("pgx://app@db/app", &recordingLogger{})
+	assert.NoError(t, err)
+	assert.NotNil(t, config.OnNotice)
+
+	_, err = pgxConfig("pgx://app@db/app?sslmode=sometimes", nil)
+	assert.Error(t, err)
+}
+
+func TestNoticeHandler(t *testing.T) {
+	log := &recordingLogger{}
+	handler := noticeHandler(log)
+
+	handler(nil, &pgconn.Notice{Severity: "NOTICE", Message: `table "test" does not exist, skipping`})
+	handler(nil, &pgconn.Notice{Severity: "WARNING", Message: "100%"})
+
+	assert.Equal(t, []string{
+		`INFO NOTICE: table "test" does not exist, skipping`,
+		"WARNING WARNING: 100%",
+	}, log.messages)
+}
+
+// connection of database/sql which isn't pgx (like lib/pq), it records executed queries.
+type fakeConn struct {
+	queries *[]string
+}
+
+func (c *fakeConn) Connect(_ context.Context) (driver.Conn, error) {
+	return c, nil
+}
+
+func (c *fakeConn) Driver() driver.Driver {
+	return nil
+}
+
+func (c *fakeConn) Prepare(_ string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	*c.queries = append(*c.queries, "COMMIT")
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	*c.queries = append(*c.queries, "ROLLBACK")
+	return nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	*c.queries = append(*c.queries, query)
+	return driver.RowsAffected(0), nil
+}
+
+func TestCopyWithoutPgx(t *testing.T) {
+	var queries []string
+
+	db := sql.OpenDB(&fakeConn{queries: &queries})
+	defer db.Close()
+
+	p := newInstance(db, database.Config{TableName: "migrations"})
+	err := p.Run(context.Background(), &database.Migration{
+		Version: 1,
+		Statements: []database.Statement{
+			{SQL: "CREATE TABLE test (id integer);", Line: 2},
+			{SQL: "COPY test FROM stdin;", Line: 3, CopyData: []byte("1\n")},
+		},
+		Record: &database.ListInfo{Version: 1, State: database.StateApplied},
+	})
+	assert.ErrorIs(t, err, ErrNoCopy)
+	assert.ErrorContains(t, err, "statement at line 3")
+
+	// the transaction is rolled back
+	assert.Equal(t, []string{"CREATE TABLE test (id integer);", "ROLLBACK"}, queries)
+}
@@ -5,26 +5,41 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"io"
+	"hash/crc64"
 	"strings"
 	"time"
 
 	"github.com/XanderKon/sql-migrator-otus/internal/database"
-	// Dynamic build.
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
-// Postgres lock mechanism based on pg_try_advisory_lock.
-//
-// crc64.Checksum([]byte("gomigrX"), crc64.MakeTable(crc64.ECMA)).
-const DefaultLockID int64 = 2726469007706392142
+// common interface of *sql.DB, *sql.Conn and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
 
 var ErrConnClose = fmt.Errorf("can't close connection")
 
+// PostgreSQL driver. DSN "postgres://..." uses lib/pq, DSN "pgx://..." uses pgx
+// which supports COPY FROM STDIN in migrations and forwards NOTICE messages to database.Config.Log.
 type Postgres struct {
 	db        *sql.DB
 	tablename string
-	ctx       context.Context
+
+	// schema of migrations table (empty -- the current one)
+	schema string
+
+	// set search_path to schema while running migrations
+	searchPath bool
+
+	// key of advisory lock
+	lockID int64
+
+	// db is passed by user and must not be closed
+	isShared bool
+
+	// connection holding advisory lock
+	lockConn *sql.Conn
 }
 
 // init itself.
@@ -32,54 +47,163 @@ func init() {
 	psql := Postgres{}
 	database.Register("postgres", &psql)
 	database.Register("postgresql", &psql)
+	database.Register("pgx", &psql)
 }
 
-func (p *Postgres) Open(url string, tablename string) (database.Driver, error) {
-	db, err := sql.Open("postgres", url)
+func (p *Postgres) Open(url string, cfg database.Config) (database.Driver, error) {
+	var (
+		db  *sql.DB
+		err error
+	)
+
+	if strings.HasPrefix(url, pgxScheme) {
+		db, err = openPgx(url, cfg.Log)
+	} else {
+		db, err = sql.Open("postgres", url)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	ctx := context.Background()
-	err = db.PingContext(ctx)
-	if err != nil {
+	// create new DB instance
+	instance := newInstance(db, cfg)
+
+	if err := instance.init(context.Background()); err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	// create new DB instance
-	instance := &Postgres{
-		db:        db,
-		tablename: tablename,
-		ctx:       ctx,
+	return instance, nil
+}
+
+// create driver for already opened connection pool.
+func (p *Postgres) WithInstance(db *sql.DB, cfg database.Config) (database.Driver, error) {
+	instance := newInstance(db, cfg)
+	instance.isShared = true
+
+	if err := instance.init(context.Background()); err != nil {
+		return nil, err
 	}
 
 	return instance, nil
 }
 
+func newInstance(db *sql.DB, cfg database.Config) *Postgres {
+	instance := &Postgres{
+		db:         db,
+		tablename:  cfg.TableName,
+		schema:     cfg.Schema,
+		searchPath: cfg.SearchPath,
+		lockID:     cfg.LockID,
+	}
+
+	// table name may be qualified by schema ("app.migrations")
+	if i := strings.LastIndex(instance.tablename, "."); i >= 0 && instance.schema == "" {
+		instance.schema, instance.tablename = instance.tablename[:i], instance.tablename[i+1:]
+	}
+
+	return instance
+}
+
+// quoted name of migrations table.
+func (p *Postgres) table() string {
+	if p.schema == "" {
+		return pq.QuoteIdentifier(p.tablename)
+	}
+
+	return pq.QuoteIdentifier(p.schema) + "." + pq.QuoteIdentifier(p.tablename)
+}
+
+// check connection and derive lock key if it isn't set.
+func (p *Postgres) init(ctx context.Context) error {
+	if err := p.db.PingContext(ctx); err != nil {
+		return err
+	}
+
+	if p.lockID != 0 {
+		return nil
+	}
+
+	var dbName, schema string
+	row := p.db.QueryRowContext(ctx, "SELECT current_database(), COALESCE(current_schema(), '')")
+	if err := row.Scan(&dbName, &schema); err != nil {
+		return fmt.Errorf("can't get current database: %w", err)
+	}
+
+	if p.schema != "" {
+		schema = p.schema
+	}
+
+	p.lockID = LockID(dbName, schema, p.tablename)
+
+	return nil
+}
+
+// LockID returns key of advisory lock for migrations table.
+func LockID(dbName, schema, table string) int64 {
+	key := strings.Join([]string{"gomigrX", dbName, schema, table}, ".")
+
+	return int64(crc64.Checksum([]byte(key), crc64.MakeTable(crc64.ECMA)))
+}
+
 func (p *Postgres) Close() error {
+	// don't leave the lock in pooled connection
+	if p.lockConn != nil {
+		_ = p.Unlock(context.Background())
+	}
+
+	if p.isShared {
+		return nil
+	}
+
 	if err := p.db.Close(); err != nil {
 		return fmt.Errorf("conn close error: %w", err)
 	}
 	return nil
 }
 
-func (p *Postgres) Lock() error {
-	row := p.db.QueryRowContext(p.ctx, "SELECT pg_try_advisory_lock($1)", DefaultLockID)
-	var locked string
+// Lock acquires session-level advisory lock. The session is kept
+// in a dedicated connection until Unlock.
+func (p *Postgres) Lock(ctx context.Context) error {
+	if p.lockConn != nil {
+		return database.ErrLocked
+	}
+
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	var locked bool
+	row := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", p.lockID)
 	if err := row.Scan(&locked); err != nil {
+		conn.Close()
 		return fmt.Errorf("failed to execute pg_try_advisory_lock: %w", err)
 	}
-	if locked != "" {
-		// A session-level advisory lock was acquired.
-		return nil
+
+	if !locked {
+		conn.Close()
+		return database.ErrLocked
 	}
 
-	return database.ErrLocked
+	p.lockConn = conn
+
+	return nil
 }
 
-func (p *Postgres) Unlock() error {
+func (p *Postgres) Unlock(ctx context.Context) error {
+	if p.lockConn == nil {
+		return database.ErrUnlock
+	}
+
+	// connection is returned to the pool anyway
+	defer func() {
+		p.lockConn.Close()
+		p.lockConn = nil
+	}()
+
 	var unlocked bool
-	row := p.db.QueryRowContext(p.ctx, "SELECT pg_advisory_unlock($1)", DefaultLockID)
+	row := p.lockConn.QueryRowContext(ctx, "SELECT pg_advisory_unlock($1)", p.lockID)
 	if err := row.Scan(&unlocked); err != nil {
 		return fmt.Errorf("failed to execute pg_advisory_unlock: %w", err)
 	}
@@ -90,66 +214,210 @@ func (p *Postgres) Unlock() error {
 	return database.ErrUnlock
 }
 
-// just run migration statement in transactions mode.
-func (p *Postgres) Run(migration io.Reader) error {
-	migr, err := io.ReadAll(migration)
+// LockHolder finds session holding advisory lock (bigint key is stored as classid and objid).
+func (p *Postgres) LockHolder(ctx context.Context) (*database.LockInfo, error) {
+	const query = `
+		SELECT a.pid, COALESCE(a.application_name, ''), COALESCE(host(a.client_addr), ''),
+			COALESCE(a.state, ''), a.backend_start
+		FROM pg_locks l
+		JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE l.locktype = 'advisory' AND l.granted
+			AND l.classid::bigint = $1 AND l.objid::bigint = $2 AND l.objsubid = 1
+		LIMIT 1;
+	`
+
+	key := uint64(p.lockID)
+
+	var (
+		info  database.LockInfo
+		since sql.NullTime
+	)
+
+	row := p.db.QueryRowContext(ctx, query, int64(key>>32), int64(key&0xFFFFFFFF))
+	err := row.Scan(&info.PID, &info.Application, &info.ClientAddr, &info.State, &since)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	info.Since = since.Time
+
+	return &info, nil
+}
+
+// run migrations and save their versions in the same transaction
+// (or without transaction if the only migration has NoTransaction set).
+// Running statement is canceled with ctx.
+func (p *Postgres) Run(ctx context.Context, migrations ...*database.Migration) error {
+	for _, migration := range migrations {
+		if migration.NoTransaction && len(migrations) > 1 {
+			return fmt.Errorf("migration %d: %w", migration.Version, database.ErrNoTransaction)
+		}
+	}
+
+	// the same session for all statements (e.g. for SET and COPY)
+	conn, err := p.db.Conn(ctx)
 	if err != nil {
 		return err
 	}
+	defer conn.Close()
 
-	query := string(migr)
-	if strings.TrimSpace(query) == "" {
-		return nil
+	// e.g. CREATE INDEX CONCURRENTLY can't be executed inside a transaction block
+	if len(migrations) == 1 && migrations[0].NoTransaction && migrations[0].Func == nil {
+		if p.searchPath && p.schema != "" {
+			if err := p.setSearchPath(ctx, conn, "SET"); err != nil {
+				return err
+			}
+
+			// don't return changed session to the pool
+			defer conn.ExecContext(context.WithoutCancel(ctx), "RESET search_path")
+		}
+
+		return p.run(ctx, conn, conn, migrations[0])
 	}
 
-	tx, err := p.db.BeginTx(p.ctx, &sql.TxOptions{})
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{})
 	if err != nil {
 		return err
 	}
 
-	if _, err := tx.Exec(query); err != nil {
-		if errRollback := tx.Rollback(); errRollback != nil {
+	if p.searchPath && p.schema != "" {
+		if err := p.setSearchPath(ctx, tx, "SET LOCAL"); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for _, migration := range migrations {
+		if err := p.run(ctx, conn, tx, migration); err != nil {
+			if len(migrations) > 1 {
+				err = fmt.Errorf("migration %d: %w", migration.Version, err)
+			}
+
+			if errRollback := tx.Rollback(); errRollback != nil {
+				return err
+			}
 			return err
 		}
-		return err
 	}
 
 	return tx.Commit()
 }
 
-func (p *Postgres) SetVersion(version int64) error {
+// set search_path to schema of migrations table (command is SET or SET LOCAL).
+func (p *Postgres) setSearchPath(ctx context.Context, e execer, command string) error {
+	if _, err := e.ExecContext(ctx, command+" search_path TO "+pq.QuoteIdentifier(p.schema)); err != nil {
+		return fmt.Errorf("can't set search_path: %w", err)
+	}
+
+	return nil
+}
+
+// execute migration and update migrations table, e is conn or transaction in it.
+func (p *Postgres) run(ctx context.Context, conn *sql.Conn, e execer, migration *database.Migration) error {
+	if migration.Func != nil {
+		tx, ok := e.(*sql.Tx)
+		if !ok {
+			return database.ErrNoTransaction
+		}
+
+		if err := migration.Func(ctx, tx); err != nil {
+			return err
+		}
+	}
+
+	for _, statement := range migration.Statements {
+		var err error
+		if statement.CopyData != nil {
+			err = copyFrom(ctx, conn, statement)
+		} else {
+			_, err = e.ExecContext(ctx, statement.SQL)
+		}
+
+		if err != nil {
+			return database.StatementError(statement, err)
+		}
+	}
+
+	if migration.Record == nil {
+		return p.deleteVersion(ctx, e, migration.Version)
+	}
+
+	migration.Record.Finish()
+
+	return p.setVersion(ctx, e, migration.Record)
+}
+
+// Insert or update row of migration.
+func (p *Postgres) SetVersion(ctx context.Context, info *database.ListInfo) error {
+	return p.setVersion(ctx, p.db, info)
+}
+
+func (p *Postgres) setVersion(ctx context.Context, e execer, info *database.ListInfo) error {
 	const query = `
-		INSERT INTO %s (version, applied_at)
-		VALUES (%d, $1)
+		INSERT INTO %s (version, name, state, started_at, finished_at, duration_ms, last_error, applied_at, checksum)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (version) DO UPDATE SET
+			name = EXCLUDED.name,
+			state = EXCLUDED.state,
+			started_at = EXCLUDED.started_at,
+			finished_at = EXCLUDED.finished_at,
+			duration_ms = EXCLUDED.duration_ms,
+			last_error = EXCLUDED.last_error,
+			applied_at = EXCLUDED.applied_at,
+			checksum = EXCLUDED.checksum
 	`
-	_, err := p.db.ExecContext(
-		p.ctx,
-		fmt.Sprintf(query, p.tablename, version),
-		time.Now(),
+	_, err := e.ExecContext(
+		ctx,
+		fmt.Sprintf(query, p.table()),
+		info.Version,
+		info.Name,
+		string(info.State),
+		nullTime(info.StartedAt),
+		nullTime(info.FinishedAt),
+		info.Duration.Milliseconds(),
+		info.LastError,
+		nullTime(info.AppliedAt),
+		info.Checksum,
 	)
+	if err != nil {
+		return fmt.Errorf("can't save version %d: %w", info.Version, err)
+	}
 
-	return err
+	return nil
 }
 
-func (p *Postgres) DeleteVersion(version int64) error {
-	const query = `DELETE FROM %s WHERE version = %d;`
+func (p *Postgres) DeleteVersion(ctx context.Context, version int64) error {
+	return p.deleteVersion(ctx, p.db, version)
+}
 
-	_, err := p.db.ExecContext(
-		p.ctx,
-		fmt.Sprintf(query, p.tablename, version),
+func (p *Postgres) deleteVersion(ctx context.Context, e execer, version int64) error {
+	const query = `DELETE FROM %s WHERE version = $1;`
+
+	_, err := e.ExecContext(
+		ctx,
+		fmt.Sprintf(query, p.table()),
+		version,
 	)
+	if err != nil {
+		return fmt.Errorf("can't delete version %d: %w", version, err)
+	}
 
-	return err
+	return nil
 }
 
 // Version returns the currently active version.
 // When no migration has been applied, it must return version -1.
-func (p *Postgres) Version() (int64, error) {
-	const query = `SELECT version FROM %s ORDER BY version DESC LIMIT 1;`
+func (p *Postgres) Version(ctx context.Context) (int64, error) {
+	const query = `SELECT version FROM %s WHERE state = $1 ORDER BY version DESC LIMIT 1;`
 
 	row := p.db.QueryRowContext(
-		p.ctx,
-		fmt.Sprintf(query, p.tablename),
+		ctx,
+		fmt.Sprintf(query, p.table()),
+		string(database.StateApplied),
 	)
 
 	var version int64
@@ -170,29 +438,51 @@ func (p *Postgres) Version() (int64, error) {
 	return version, nil
 }
 
-// List returns the slice of all apllied versions of migraions.
-// When no migration has been applied, it must return empty slice.
-func (p *Postgres) List() ([]*database.ListInfo, error) {
-	const query = `SELECT version, applied_at FROM %s ORDER BY version;`
+// List returns the slice of all saved versions of migraions in any state.
+// When no migration has been saved, it must return empty slice.
+func (p *Postgres) List(ctx context.Context) ([]*database.ListInfo, error) {
+	const query = `
+		SELECT version, name, state, started_at, finished_at, duration_ms, last_error, applied_at, checksum
+		FROM %s ORDER BY version;
+	`
 
-	rows, err := p.db.QueryContext(p.ctx, fmt.Sprintf(query, p.tablename))
+	rows, err := p.db.QueryContext(ctx, fmt.Sprintf(query, p.table()))
 	if err != nil {
 		return []*database.ListInfo{}, err
 	}
 	defer rows.Close()
 
-	var versions []*database.ListInfo
+	versions := make([]*database.ListInfo, 0)
 
 	for rows.Next() {
-		v := &database.ListInfo{}
+		var (
+			v                                = &database.ListInfo{}
+			state                            string
+			startedAt, finishedAt, appliedAt sql.NullTime
+			duration                         int64
+		)
+
 		err := rows.Scan(
 			&v.Version,
-			&v.AppliedAt,
+			&v.Name,
+			&state,
+			&startedAt,
+			&finishedAt,
+			&duration,
+			&v.LastError,
+			&appliedAt,
+			&v.Checksum,
 		)
 		if err != nil {
 			return nil, err
 		}
 
+		v.State = database.State(state)
+		v.StartedAt = startedAt.Time
+		v.FinishedAt = finishedAt.Time
+		v.Duration = time.Duration(duration) * time.Millisecond
+		v.AppliedAt = appliedAt.Time
+
 		versions = append(versions, v)
 	}
 
@@ -203,19 +493,43 @@ func (p *Postgres) List() ([]*database.ListInfo, error) {
 	return versions, nil
 }
 
-// Create migrations table.
-func (p *Postgres) PrepareTable() error {
+// Create migrations table (or add new columns to the table created by previous versions).
+func (p *Postgres) PrepareTable(ctx context.Context) error {
+	if p.schema != "" {
+		_, err := p.db.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+pq.QuoteIdentifier(p.schema))
+		if err != nil {
+			return fmt.Errorf("can't create schema %s: %w", p.schema, err)
+		}
+	}
+
 	const query = `
-		CREATE TABLE IF NOT EXISTS %s (
+		CREATE TABLE IF NOT EXISTS %[1]s (
 			id serial NOT NULL,
 			version bigint NOT NULL,
-			applied_at timestamp NOT NULL,
+			name text NOT NULL DEFAULT '',
+			state varchar(16) NOT NULL DEFAULT 'applied',
+			started_at timestamp NULL,
+			finished_at timestamp NULL,
+			duration_ms bigint NOT NULL DEFAULT 0,
+			last_error text NOT NULL DEFAULT '',
+			applied_at timestamp NULL,
+			checksum varchar(64) NOT NULL DEFAULT '',
 			PRIMARY KEY(id),
 			UNIQUE(version)
-	);`
+		);
+		ALTER TABLE %[1]s
+			ADD COLUMN IF NOT EXISTS name text NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS state varchar(16) NOT NULL DEFAULT 'applied',
+			ADD COLUMN IF NOT EXISTS started_at timestamp NULL,
+			ADD COLUMN IF NOT EXISTS finished_at timestamp NULL,
+			ADD COLUMN IF NOT EXISTS duration_ms bigint NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS last_error text NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS checksum varchar(64) NOT NULL DEFAULT '',
+			ALTER COLUMN applied_at DROP NOT NULL;
+	`
 	_, err := p.db.ExecContext(
-		p.ctx,
-		fmt.Sprintf(query, p.tablename),
+		ctx,
+		fmt.Sprintf(query, p.table()),
 	)
 	if err != nil {
 		return err
@@ -223,3 +537,8 @@ func (p *Postgres) PrepareTable() error {
 
 	return nil
 }
+
+// zero time is stored as NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,38 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/XanderKon/sql-migrator-otus/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockID(t *testing.T) {
+	id := LockID("app", "public", "migrations")
+
+	// stable between runs
+	assert.Equal(t, id, LockID("app", "public", "migrations"))
+
+	// independent migration sets
+	assert.NotEqual(t, id, LockID("app", "public", "billing_migrations"))
+	assert.NotEqual(t, id, LockID("app", "billing", "migrations"))
+	assert.NotEqual(t, id, LockID("other", "public", "migrations"))
+}
+
+func TestTableName(t *testing.T) {
+	tests := []struct {
+		cfg      database.Config
+		expected string
+	}{
+		{cfg: database.Config{TableName: "migrations"}, expected: `"migrations"`},
+		{cfg: database.Config{TableName: "Migrations", Schema: "app"}, expected: `"app"."Migrations"`},
+		{cfg: database.Config{TableName: "my_schema.migrations"}, expected: `"my_schema"."migrations"`},
+		{cfg: database.Config{TableName: `bad"; DROP TABLE users; --`}, expected: `"bad""; DROP TABLE users; --"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cfg.TableName, func(t *testing.T) {
+			assert.Equal(t, tt.expected, newInstance(nil, tt.cfg).table())
+		})
+	}
+}
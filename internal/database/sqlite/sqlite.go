@@ -0,0 +1,441 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/XanderKon/sql-migrator-otus/internal/database"
+	// Pure Go driver (works with CGO_ENABLED=0).
+	_ "modernc.org/sqlite"
+)
+
+// common interface of *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// format of timestamps stored in migrations table.
+const timeFormat = time.RFC3339Nano
+
+// SQLite driver, DSN looks like "sqlite://path/to/file.db" (or "sqlite:///abs/path.db").
+// Parameters of modernc.org/sqlite are supported as well, e.g.
+// "sqlite://app.db?_pragma=busy_timeout(5000)".
+//
+// Lock is implemented by a row in "<table>_lock" table, so it works between
+// processes using the same file. Schema and SearchPath of database.Config are ignored.
+type SQLite struct {
+	db        *sql.DB
+	tablename string
+
+	// db is passed by user and must not be closed
+	isShared bool
+}
+
+// init itself.
+func init() {
+	lite := SQLite{}
+	database.Register("sqlite", &lite)
+	database.Register("sqlite3", &lite)
+}
+
+func (s *SQLite) Open(url string, cfg database.Config) (database.Driver, error) {
+	i := strings.Index(url, "://")
+	if i < 0 {
+		return nil, database.ErrParseDSN
+	}
+
+	db, err := sql.Open("sqlite", url[i+3:])
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows only one writer, so the single connection is enough
+	// (and avoids "database is locked" errors between our own connections).
+	db.SetMaxOpenConns(1)
+
+	instance := &SQLite{
+		db:        db,
+		tablename: cfg.TableName,
+	}
+
+	if err := instance.init(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return instance, nil
+}
+
+// create driver for already opened connection pool.
+func (s *SQLite) WithInstance(db *sql.DB, cfg database.Config) (database.Driver, error) {
+	instance := &SQLite{
+		db:        db,
+		tablename: cfg.TableName,
+		isShared:  true,
+	}
+
+	if err := instance.init(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return instance, nil
+}
+
+// check connection and create lock table (it's needed before PrepareTable).
+func (s *SQLite) init(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return err
+	}
+
+	const query = `
+		CREATE TABLE IF NOT EXISTS %s (
+			id integer NOT NULL PRIMARY KEY,
+			pid integer NOT NULL,
+			hostname text NOT NULL,
+			locked_at text NOT NULL
+		);
+	`
+
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(query, s.lockTable()))
+
+	return err
+}
+
+func (s *SQLite) Close() error {
+	if s.isShared {
+		return nil
+	}
+
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("conn close error: %w", err)
+	}
+	return nil
+}
+
+// Lock inserts the only row to lock table, the row is already there if
+// another process holds the lock.
+func (s *SQLite) Lock(ctx context.Context) error {
+	const query = `INSERT INTO %s (id, pid, hostname, locked_at) VALUES (1, ?, ?, ?) ON CONFLICT (id) DO NOTHING;`
+
+	hostname, _ := os.Hostname()
+
+	res, err := s.db.ExecContext(
+		ctx,
+		fmt.Sprintf(query, s.lockTable()),
+		os.Getpid(),
+		hostname,
+		time.Now().UTC().Format(timeFormat),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if inserted == 0 {
+		return database.ErrLocked
+	}
+
+	return nil
+}
+
+func (s *SQLite) Unlock(ctx context.Context) error {
+	const query = `DELETE FROM %s WHERE id = 1;`
+
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(query, s.lockTable()))
+	if err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return database.ErrUnlock
+	}
+
+	return nil
+}
+
+// LockHolder returns process which inserted the lock row. The row stays
+// if the process was killed, then it should be deleted manually.
+func (s *SQLite) LockHolder(ctx context.Context) (*database.LockInfo, error) {
+	const query = `SELECT pid, hostname, locked_at FROM %s WHERE id = 1;`
+
+	var (
+		info     database.LockInfo
+		lockedAt string
+	)
+
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(query, s.lockTable()))
+	err := row.Scan(&info.PID, &info.ClientAddr, &lockedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	info.Since, _ = time.Parse(timeFormat, lockedAt)
+
+	return &info, nil
+}
+
+// run migrations and save their versions in the same transaction
+// (or without transaction if the only migration has NoTransaction set).
+func (s *SQLite) Run(ctx context.Context, migrations ...*database.Migration) error {
+	// e.g. VACUUM can't be executed inside a transaction
+	if len(migrations) == 1 && migrations[0].NoTransaction && migrations[0].Func == nil {
+		return s.run(ctx, s.db, migrations[0])
+	}
+
+	for _, migration := range migrations {
+		if migration.NoTransaction && len(migrations) > 1 {
+			return fmt.Errorf("migration %d: %w", migration.Version, database.ErrNoTransaction)
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if err := s.run(ctx, tx, migration); err != nil {
+			if len(migrations) > 1 {
+				err = fmt.Errorf("migration %d: %w", migration.Version, err)
+			}
+
+			if errRollback := tx.Rollback(); errRollback != nil {
+				return err
+			}
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// execute migration and update migrations table.
+func (s *SQLite) run(ctx context.Context, e execer, migration *database.Migration) error {
+	if migration.Func != nil {
+		tx, ok := e.(*sql.Tx)
+		if !ok {
+			return database.ErrNoTransaction
+		}
+
+		if err := migration.Func(ctx, tx); err != nil {
+			return err
+		}
+	}
+
+	for _, statement := range migration.Statements {
+		if _, err := e.ExecContext(ctx, statement.SQL); err != nil {
+			return database.StatementError(statement, err)
+		}
+	}
+
+	if migration.Record == nil {
+		return s.deleteVersion(ctx, e, migration.Version)
+	}
+
+	migration.Record.Finish()
+
+	return s.setVersion(ctx, e, migration.Record)
+}
+
+// Insert or update row of migration.
+func (s *SQLite) SetVersion(ctx context.Context, info *database.ListInfo) error {
+	return s.setVersion(ctx, s.db, info)
+}
+
+func (s *SQLite) setVersion(ctx context.Context, e execer, info *database.ListInfo) error {
+	const query = `
+		INSERT INTO %s (version, name, state, started_at, finished_at, duration_ms, last_error, applied_at, checksum)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (version) DO UPDATE SET
+			name = excluded.name,
+			state = excluded.state,
+			started_at = excluded.started_at,
+			finished_at = excluded.finished_at,
+			duration_ms = excluded.duration_ms,
+			last_error = excluded.last_error,
+			applied_at = excluded.applied_at,
+			checksum = excluded.checksum
+	`
+	_, err := e.ExecContext(
+		ctx,
+		fmt.Sprintf(query, s.table()),
+		info.Version,
+		info.Name,
+		string(info.State),
+		formatTime(info.StartedAt),
+		formatTime(info.FinishedAt),
+		info.Duration.Milliseconds(),
+		info.LastError,
+		formatTime(info.AppliedAt),
+		info.Checksum,
+	)
+	if err != nil {
+		return fmt.Errorf("can't save version %d: %w", info.Version, err)
+	}
+
+	return nil
+}
+
+func (s *SQLite) DeleteVersion(ctx context.Context, version int64) error {
+	return s.deleteVersion(ctx, s.db, version)
+}
+
+func (s *SQLite) deleteVersion(ctx context.Context, e execer, version int64) error {
+	const query = `DELETE FROM %s WHERE version = ?;`
+
+	if _, err := e.ExecContext(ctx, fmt.Sprintf(query, s.table()), version); err != nil {
+		return fmt.Errorf("can't delete version %d: %w", version, err)
+	}
+
+	return nil
+}
+
+// Version returns the currently active version.
+// When no migration has been applied, it must return version -1.
+func (s *SQLite) Version(ctx context.Context) (int64, error) {
+	const query = `SELECT version FROM %s WHERE state = ? ORDER BY version DESC LIMIT 1;`
+
+	var version int64
+
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(query, s.table()), string(database.StateApplied))
+	err := row.Scan(&version)
+
+	// If not migrations applied yet
+	if errors.Is(err, sql.ErrNoRows) {
+		return -1, nil
+	}
+
+	if err != nil {
+		return -1, err
+	}
+
+	return version, nil
+}
+
+// List returns the slice of all saved versions of migraions in any state.
+// When no migration has been saved, it must return empty slice.
+func (s *SQLite) List(ctx context.Context) ([]*database.ListInfo, error) {
+	const query = `
+		SELECT version, name, state, started_at, finished_at, duration_ms, last_error, applied_at, checksum
+		FROM %s ORDER BY version;
+	`
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(query, s.table()))
+	if err != nil {
+		return []*database.ListInfo{}, err
+	}
+	defer rows.Close()
+
+	versions := make([]*database.ListInfo, 0)
+
+	for rows.Next() {
+		var (
+			v                                = &database.ListInfo{}
+			state                            string
+			startedAt, finishedAt, appliedAt sql.NullString
+			duration                         int64
+		)
+
+		err := rows.Scan(
+			&v.Version,
+			&v.Name,
+			&state,
+			&startedAt,
+			&finishedAt,
+			&duration,
+			&v.LastError,
+			&appliedAt,
+			&v.Checksum,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		v.State = database.State(state)
+		v.StartedAt = parseTime(startedAt)
+		v.FinishedAt = parseTime(finishedAt)
+		v.Duration = time.Duration(duration) * time.Millisecond
+		v.AppliedAt = parseTime(appliedAt)
+
+		versions = append(versions, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// Create migrations table.
+func (s *SQLite) PrepareTable(ctx context.Context) error {
+	const query = `
+		CREATE TABLE IF NOT EXISTS %s (
+			id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+			version integer NOT NULL UNIQUE,
+			name text NOT NULL DEFAULT '',
+			state text NOT NULL DEFAULT 'applied',
+			started_at text NULL,
+			finished_at text NULL,
+			duration_ms integer NOT NULL DEFAULT 0,
+			last_error text NOT NULL DEFAULT '',
+			applied_at text NULL,
+			checksum text NOT NULL DEFAULT ''
+		);
+	`
+
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(query, s.table()))
+
+	return err
+}
+
+// quoted name of migrations table.
+func (s *SQLite) table() string {
+	return quoteIdentifier(s.tablename)
+}
+
+// quoted name of lock table.
+func (s *SQLite) lockTable() string {
+	return quoteIdentifier(s.tablename + "_lock")
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// zero time is stored as NULL.
+func formatTime(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+
+	return sql.NullString{String: t.UTC().Format(timeFormat), Valid: true}
+}
+
+func parseTime(s sql.NullString) time.Time {
+	if !s.Valid {
+		return time.Time{}
+	}
+
+	t, _ := time.Parse(timeFormat, s.String)
+
+	return t
+}
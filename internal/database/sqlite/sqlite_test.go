@@ -0,0 +1,250 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/XanderKon/sql-migrator-otus/internal/database"
+	"github.com/XanderKon/sql-migrator-otus/pkg/database/drivertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tableName = "migrations"
+
+func openDriver(t *testing.T, path string) database.Driver {
+	t.Helper()
+
+	driver, err := database.Open("sqlite://"+path, database.Config{TableName: tableName})
+	require.NoError(t, err)
+	t.Cleanup(func() { driver.Close() })
+
+	require.NoError(t, driver.PrepareTable(context.Background()))
+
+	return driver
+}
+
+func tableExists(t *testing.T, path, name string) bool {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var count int
+	err = db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&count)
+	require.NoError(t, err)
+
+	return count > 0
+}
+
+func TestOpen(t *testing.T) {
+	_, err := database.Open("sqlite:missing-slashes.db", database.Config{TableName: tableName})
+	assert.ErrorIs(t, err, database.ErrParseDSN)
+
+	driver, err := database.Open("sqlite3://"+filepath.Join(t.TempDir(), "app.db"), database.Config{TableName: tableName})
+	require.NoError(t, err)
+	assert.NoError(t, driver.Close())
+}
+
+func TestVersions(t *testing.T) {
+	ctx := context.Background()
+	driver := openDriver(t, filepath.Join(t.TempDir(), "app.db"))
+
+	version, err := driver.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), version)
+
+	list, err := driver.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	startedAt := time.Date(2024, 1, 20, 19, 58, 17, 123456789, time.UTC)
+	applied := &database.ListInfo{
+		Version:    1,
+		Name:       "1_init.sql",
+		State:      database.StateApplied,
+		StartedAt:  startedAt,
+		FinishedAt: startedAt.Add(time.Second),
+		Duration:   time.Second,
+		AppliedAt:  startedAt.Add(time.Second),
+		Checksum:   "abc",
+	}
+	require.NoError(t, driver.SetVersion(ctx, applied))
+	require.NoError(t, driver.SetVersion(ctx, &database.ListInfo{
+		Version:   2,
+		Name:      "2_broken.sql",
+		State:     database.StateError,
+		StartedAt: startedAt,
+		LastError: "boom",
+	}))
+
+	// failed migration isn't current version
+	version, err = driver.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+
+	list, err = driver.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, applied, list[0])
+	assert.Equal(t, "boom", list[1].LastError)
+	assert.True(t, list[1].AppliedAt.IsZero())
+
+	// update of existing row, applying migration isn't current version as well
+	applied.State = database.StateApplying
+	require.NoError(t, driver.SetVersion(ctx, applied))
+
+	require.NoError(t, driver.DeleteVersion(ctx, 2))
+
+	list, err = driver.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, database.StateApplying, list[0].State)
+
+	version, err = driver.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), version)
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "app.db")
+	driver := openDriver(t, path)
+
+	record := &database.ListInfo{Version: 1, Name: "1_init.sql", State: database.StateApplied, StartedAt: time.Now()}
+	err := driver.Run(ctx, &database.Migration{
+		Version:    1,
+		Statements: []database.Statement{{SQL: "CREATE TABLE test (id integer);", Line: 2}},
+		Record:     record,
+	})
+	require.NoError(t, err)
+	assert.True(t, tableExists(t, path, "test"))
+	assert.False(t, record.AppliedAt.IsZero())
+
+	version, err := driver.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+
+	// rollback deletes the version
+	err = driver.Run(ctx, &database.Migration{
+		Version:    1,
+		Statements: []database.Statement{{SQL: "DROP TABLE test;", Line: 5}},
+	})
+	require.NoError(t, err)
+	assert.False(t, tableExists(t, path, "test"))
+
+	list, err := driver.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestRunAtomic(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "app.db")
+	driver := openDriver(t, path)
+
+	record := &database.ListInfo{Version: 1, Name: "1_broken.sql", State: database.StateApplied, StartedAt: time.Now()}
+
+	// the second statement fails, so neither the table nor the version should be saved.
+	err := driver.Run(ctx, &database.Migration{
+		Version: 1,
+		Statements: []database.Statement{
+			{SQL: "CREATE TABLE test (id integer);", Line: 2},
+			{SQL: "SELECT * FROM missing_table;", Line: 3},
+		},
+		Record: record,
+	})
+	assert.ErrorContains(t, err, "statement at line 3")
+
+	list, err := driver.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+	assert.False(t, tableExists(t, path, "test"))
+
+	// the whole batch is rolled back when one of migrations fails.
+	err = driver.Run(ctx,
+		&database.Migration{
+			Version:    1,
+			Statements: []database.Statement{{SQL: "CREATE TABLE test (id integer);", Line: 1}},
+			Record:     &database.ListInfo{Version: 1, State: database.StateApplied},
+		},
+		&database.Migration{
+			Version:    2,
+			Statements: []database.Statement{{SQL: "SELECT * FROM missing_table;", Line: 1}},
+			Record:     &database.ListInfo{Version: 2, State: database.StateApplied},
+		},
+	)
+	assert.ErrorContains(t, err, "migration 2")
+
+	list, err = driver.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+	assert.False(t, tableExists(t, path, "test"))
+}
+
+func TestRunNoTransaction(t *testing.T) {
+	ctx := context.Background()
+	driver := openDriver(t, filepath.Join(t.TempDir(), "app.db"))
+
+	// VACUUM fails inside a transaction
+	err := driver.Run(ctx, &database.Migration{
+		Version:       1,
+		Statements:    []database.Statement{{SQL: "VACUUM;", Line: 1}},
+		NoTransaction: true,
+		Record:        &database.ListInfo{Version: 1, State: database.StateApplied},
+	})
+	require.NoError(t, err)
+
+	noTx := &database.Migration{Version: 2, NoTransaction: true, Record: &database.ListInfo{Version: 2}}
+	err = driver.Run(ctx, noTx, noTx)
+	assert.ErrorIs(t, err, database.ErrNoTransaction)
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "app.db")
+	driver := openDriver(t, path)
+	other := openDriver(t, path)
+
+	holder, err := other.(database.LockHolder).LockHolder(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, holder)
+
+	require.NoError(t, driver.Lock(ctx))
+
+	// the lock is held by another connection.
+	assert.ErrorIs(t, other.Lock(ctx), database.ErrLocked)
+
+	holder, err = other.(database.LockHolder).LockHolder(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, holder)
+	assert.Positive(t, holder.PID)
+	assert.False(t, holder.Since.IsZero())
+
+	require.NoError(t, driver.Unlock(ctx))
+	assert.ErrorIs(t, driver.Unlock(ctx), database.ErrUnlock)
+
+	// ...and free now.
+	require.NoError(t, other.Lock(ctx))
+	require.NoError(t, other.Unlock(ctx))
+}
+
+func TestTableName(t *testing.T) {
+	s := &SQLite{tablename: `bad"; DROP TABLE users; --`}
+
+	assert.Equal(t, `"bad""; DROP TABLE users; --"`, s.table())
+	assert.Equal(t, `"bad""; DROP TABLE users; --_lock"`, s.lockTable())
+}
+
+func TestConformance(t *testing.T) {
+	drivertest.Run(t, func(t *testing.T) database.Driver {
+		driver, err := database.Open("sqlite://"+filepath.Join(t.TempDir(), "app.db"), database.Config{TableName: tableName})
+		require.NoError(t, err)
+
+		return driver
+	})
+}
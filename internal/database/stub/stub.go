@@ -1,17 +1,23 @@
 package stub
 
 import (
-	"io"
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
 
 	"github.com/XanderKon/sql-migrator-otus/internal/database"
 )
 
+// Stub keeps versions in memory, statements are ignored.
+// Zero value is ready to use.
 type Stub struct {
 	url       string
 	tablename string
 	isLocked  bool
-	version   int64
-	list      []*database.ListInfo
+
+	// sorted by version
+	list []database.ListInfo
 }
 
 // init itself.
@@ -20,58 +26,141 @@ func init() {
 	database.Register("stub", &s)
 }
 
-func (p *Stub) Open(url string, tablename string) (database.Driver, error) {
+func (p *Stub) Open(url string, cfg database.Config) (database.Driver, error) {
 	// create new DB instance
 	instance := &Stub{
 		url:       url,
-		tablename: tablename,
+		tablename: cfg.TableName,
 	}
 
 	return instance, nil
 }
 
+// connection is not used by stub.
+func (p *Stub) WithInstance(_ *sql.DB, cfg database.Config) (database.Driver, error) {
+	return p.Open("stub://", cfg)
+}
+
 func (p *Stub) Close() error {
 	return nil
 }
 
-func (p *Stub) Lock() error {
+func (p *Stub) Lock(_ context.Context) error {
 	if p.isLocked {
 		return database.ErrLocked
 	}
+
+	p.isLocked = true
+
 	return nil
 }
 
-func (p *Stub) Unlock() error {
+func (p *Stub) Unlock(_ context.Context) error {
+	if !p.isLocked {
+		return database.ErrUnlock
+	}
+
+	p.isLocked = false
+
 	return nil
 }
 
-func (p *Stub) Run(_ io.Reader) error {
+// run Go-code without real transaction, statements are ignored.
+// Versions are restored if any migration fails.
+func (p *Stub) Run(ctx context.Context, migrations ...*database.Migration) error {
+	for _, migration := range migrations {
+		if migration.NoTransaction && len(migrations) > 1 {
+			return fmt.Errorf("migration %d: %w", migration.Version, database.ErrNoTransaction)
+		}
+	}
+
+	saved := append([]database.ListInfo(nil), p.list...)
+
+	for _, migration := range migrations {
+		if err := p.run(ctx, migration); err != nil {
+			p.list = saved
+
+			if len(migrations) > 1 {
+				return fmt.Errorf("migration %d: %w", migration.Version, err)
+			}
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (p *Stub) SetVersion(version int64) error {
-	p.version = version
+func (p *Stub) run(ctx context.Context, migration *database.Migration) error {
+	if migration.Func != nil {
+		if err := migration.Func(ctx, nil); err != nil {
+			return err
+		}
+	}
+
+	if migration.Record == nil {
+		return p.DeleteVersion(ctx, migration.Version)
+	}
+
+	migration.Record.Finish()
+
+	return p.SetVersion(ctx, migration.Record)
+}
+
+func (p *Stub) SetVersion(_ context.Context, info *database.ListInfo) error {
+	i := p.find(info.Version)
+	if i < len(p.list) && p.list[i].Version == info.Version {
+		p.list[i] = *info
+		return nil
+	}
+
+	p.list = append(p.list, database.ListInfo{})
+	copy(p.list[i+1:], p.list[i:])
+	p.list[i] = *info
 
 	return nil
 }
 
-func (p *Stub) DeleteVersion(_ int64) error {
+func (p *Stub) DeleteVersion(_ context.Context, version int64) error {
+	i := p.find(version)
+	if i < len(p.list) && p.list[i].Version == version {
+		p.list = append(p.list[:i], p.list[i+1:]...)
+	}
+
 	return nil
 }
 
+// position of version in sorted list.
+func (p *Stub) find(version int64) int {
+	return sort.Search(len(p.list), func(i int) bool {
+		return p.list[i].Version >= version
+	})
+}
+
 // Version returns the currently active version.
 // When no migration has been applied, it must return version -1.
-func (p *Stub) Version() (int64, error) {
-	return p.version, nil
+func (p *Stub) Version(_ context.Context) (int64, error) {
+	for i := len(p.list) - 1; i >= 0; i-- {
+		if p.list[i].State == database.StateApplied {
+			return p.list[i].Version, nil
+		}
+	}
+
+	return -1, nil
 }
 
-// List returns the slice of all apllied versions of migraions.
-// When no migration has been applied, it must return empty slice.
-func (p *Stub) List() ([]*database.ListInfo, error) {
-	return p.list, nil
+// List returns the slice of all saved versions of migraions in any state.
+// When no migration has been saved, it must return empty slice.
+func (p *Stub) List(_ context.Context) ([]*database.ListInfo, error) {
+	list := make([]*database.ListInfo, 0, len(p.list))
+	for i := range p.list {
+		info := p.list[i]
+		list = append(list, &info)
+	}
+
+	return list, nil
 }
 
 // Create migrations table.
-func (p *Stub) PrepareTable() error {
+func (p *Stub) PrepareTable(_ context.Context) error {
 	return nil
 }
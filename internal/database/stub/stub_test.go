@@ -0,0 +1,19 @@
+package stub_test
+
+import (
+	"testing"
+
+	"github.com/XanderKon/sql-migrator-otus/internal/database"
+	_ "github.com/XanderKon/sql-migrator-otus/internal/database/stub"
+	"github.com/XanderKon/sql-migrator-otus/pkg/database/drivertest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	drivertest.Run(t, func(t *testing.T) database.Driver {
+		driver, err := database.Open("stub://", database.Config{TableName: "migrations"})
+		require.NoError(t, err)
+
+		return driver
+	})
+}
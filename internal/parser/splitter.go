@@ -0,0 +1,256 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// statement reading data which follows it.
+var copyFromStdin = regexp.MustCompile(`(?is)^COPY\s.*\sFROM\s+STDIN\b`)
+
+// line terminating data of COPY FROM STDIN.
+const copyEnd = `\.`
+
+type splitState int
+
+const (
+	stateNormal splitState = iota
+	stateString
+	stateEscapeString
+	stateIdentifier
+	stateLineComment
+	stateBlockComment
+	stateDollarQuote
+)
+
+// splitter splits SQL to statements by semicolons which are not placed
+// inside of quoted strings, identifiers, dollar-quoted strings and comments.
+// Lines between StatementBegin and StatementEnd annotations are kept as one statement.
+// Lines after COPY FROM STDIN statement up to "\." are data of the statement.
+type splitter struct {
+	statements []Statement
+
+	// current statement and line where it begins (0 -- only spaces and comments yet)
+	buf  strings.Builder
+	line int
+
+	state splitState
+
+	// tag of current dollar-quoted string (e.g. "$$" or "$body$")
+	tag string
+
+	// nesting level of block comments
+	depth int
+
+	inBlock bool
+
+	// data of the last statement (COPY FROM STDIN) is being read
+	inCopy bool
+	data   []byte
+}
+
+// start StatementBegin block.
+func (s *splitter) begin() error {
+	if s.inBlock {
+		return ErrStatementBlock
+	}
+
+	s.flush()
+	s.state = stateNormal
+	s.inBlock = true
+
+	return nil
+}
+
+// finish StatementBegin block.
+func (s *splitter) end() error {
+	if !s.inBlock {
+		return ErrStatementBlock
+	}
+
+	s.flush()
+	s.inBlock = false
+
+	return nil
+}
+
+// return all statements (the last one may be without semicolon).
+func (s *splitter) finish() ([]Statement, error) {
+	if s.inBlock {
+		return nil, ErrStatementBlock
+	}
+
+	s.flush()
+
+	if s.inCopy {
+		return nil, ErrCopyData
+	}
+
+	return s.statements, nil
+}
+
+func (s *splitter) writeLine(line string, num int) {
+	if s.inCopy {
+		s.writeCopyData(line)
+		return
+	}
+
+	if s.inBlock {
+		if s.line == 0 && strings.TrimSpace(line) != "" {
+			s.line = num
+		}
+
+		s.buf.WriteString(line + "\n")
+		return
+	}
+
+	text := line + "\n"
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+
+		switch s.state {
+		case stateNormal:
+			switch {
+			case strings.HasPrefix(text[i:], "--"):
+				s.state = stateLineComment
+			case strings.HasPrefix(text[i:], "/*"):
+				s.state = stateBlockComment
+				s.depth = 1
+				s.buf.WriteByte(c)
+				i++
+				c = text[i]
+			case c == '\'':
+				s.start(num)
+				s.state = stateString
+				// E'...' supports backslash escapes
+				if i > 0 && (text[i-1] == 'E' || text[i-1] == 'e') && (i < 2 || !isIdentChar(text[i-2])) {
+					s.state = stateEscapeString
+				}
+			case c == '"':
+				s.start(num)
+				s.state = stateIdentifier
+			case c == '$' && (i == 0 || !isIdentChar(text[i-1])):
+				s.start(num)
+				if tag := dollarTag(text[i:]); tag != "" {
+					s.state = stateDollarQuote
+					s.tag = tag
+					s.buf.WriteString(tag)
+					i += len(tag) - 1
+					continue
+				}
+			case c == ';':
+				// empty statements are skipped by flush
+				s.buf.WriteByte(c)
+				s.flush()
+
+				// the rest of line is ignored like by psql
+				if s.inCopy {
+					return
+				}
+				continue
+			case c != ' ' && c != '\t' && c != '\r' && c != '\n':
+				s.start(num)
+			}
+		case stateString, stateEscapeString:
+			if c == '\\' && s.state == stateEscapeString && i+1 < len(text) {
+				s.buf.WriteByte(c)
+				i++
+				c = text[i]
+			} else if c == '\'' {
+				// '' is an escaped quote, it is handled as two strings in a row
+				s.state = stateNormal
+			}
+		case stateIdentifier:
+			if c == '"' {
+				s.state = stateNormal
+			}
+		case stateLineComment:
+			if c == '\n' {
+				s.state = stateNormal
+			}
+		case stateBlockComment:
+			switch {
+			case strings.HasPrefix(text[i:], "/*"):
+				s.depth++
+				s.buf.WriteByte(c)
+				i++
+				c = text[i]
+			case strings.HasPrefix(text[i:], "*/"):
+				s.depth--
+				if s.depth == 0 {
+					s.state = stateNormal
+				}
+				s.buf.WriteByte(c)
+				i++
+				c = text[i]
+			}
+		case stateDollarQuote:
+			if strings.HasPrefix(text[i:], s.tag) {
+				s.state = stateNormal
+				s.buf.WriteString(s.tag)
+				i += len(s.tag) - 1
+				continue
+			}
+		}
+
+		s.buf.WriteByte(c)
+	}
+}
+
+// mark beginning of statement, leading spaces and comments are dropped.
+func (s *splitter) start(num int) {
+	if s.line == 0 {
+		s.line = num
+		s.buf.Reset()
+	}
+}
+
+// save current statement if it isn't empty.
+func (s *splitter) flush() {
+	if s.line != 0 {
+		statement := Statement{
+			SQL:  strings.TrimSpace(s.buf.String()),
+			Line: s.line,
+		}
+
+		s.statements = append(s.statements, statement)
+		s.inCopy = !s.inBlock && copyFromStdin.MatchString(statement.SQL)
+		s.data = []byte{}
+	}
+
+	s.buf.Reset()
+	s.line = 0
+}
+
+// add line to data of COPY FROM STDIN statement.
+func (s *splitter) writeCopyData(line string) {
+	if line == copyEnd {
+		s.statements[len(s.statements)-1].CopyData = s.data
+		s.inCopy = false
+		return
+	}
+
+	s.data = append(s.data, line+"\n"...)
+}
+
+// get tag of dollar quote at the beginning of text ("$$", "$tag$") or empty string.
+func dollarTag(text string) string {
+	for i := 1; i < len(text); i++ {
+		c := text[i]
+		if c == '$' {
+			return text[:i+1]
+		}
+
+		// tag can't start with digit ($1 is a parameter)
+		if !isIdentChar(c) || (i == 1 && c >= '0' && c <= '9') {
+			return ""
+		}
+	}
+
+	return ""
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c >= 0x80
+}
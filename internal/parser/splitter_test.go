@@ -0,0 +1,163 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitter(t *testing.T) {
+	tests := []struct {
+		label    string
+		sql      string
+		expected []Statement
+	}{
+		{
+			label: "simple statements",
+			sql:   "CREATE TABLE test (id int);\n\nINSERT INTO test VALUES (1); INSERT INTO test VALUES (2);\n",
+			expected: []Statement{
+				{SQL: "CREATE TABLE test (id int);", Line: 1},
+				{SQL: "INSERT INTO test VALUES (1);", Line: 3},
+				{SQL: "INSERT INTO test VALUES (2);", Line: 3},
+			},
+		},
+		{
+			label: "without last semicolon",
+			sql:   "SELECT 1;\nSELECT\n  2\n",
+			expected: []Statement{
+				{SQL: "SELECT 1;", Line: 1},
+				{SQL: "SELECT\n  2", Line: 2},
+			},
+		},
+		{
+			label: "quoted strings and identifiers",
+			sql:   "INSERT INTO \"semi;colon\" VALUES ('a;b', 'it''s;', E'\\';');\nSELECT 1;\n",
+			expected: []Statement{
+				{SQL: "INSERT INTO \"semi;colon\" VALUES ('a;b', 'it''s;', E'\\';');", Line: 1},
+				{SQL: "SELECT 1;", Line: 2},
+			},
+		},
+		{
+			label: "comments",
+			sql:   "-- leading; comment\nSELECT 1; -- trailing; comment\n/* block; /* nested; */ comment */\nSELECT /* ; */ 2;\n-- the end;\n",
+			expected: []Statement{
+				{SQL: "SELECT 1;", Line: 2},
+				{SQL: "SELECT /* ; */ 2;", Line: 4},
+			},
+		},
+		{
+			label: "dollar quoting",
+			sql:   "CREATE FUNCTION f() RETURNS int AS $$\nBEGIN\n  RETURN 1;\nEND;\n$$ LANGUAGE plpgsql;\nSELECT $tag$;$$;$tag$, $1;\n",
+			expected: []Statement{
+				{SQL: "CREATE FUNCTION f() RETURNS int AS $$\nBEGIN\n  RETURN 1;\nEND;\n$$ LANGUAGE plpgsql;", Line: 1},
+				{SQL: "SELECT $tag$;$$;$tag$, $1;", Line: 6},
+			},
+		},
+		{
+			label:    "only comments",
+			sql:      "-- nothing here;\n\n;\n",
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			migration, err := ParseMigration(strings.NewReader("-- +gomigrator Up\n" + test.sql))
+			assert.NoError(t, err)
+
+			// line numbers are shifted by Up annotation
+			for i := range test.expected {
+				test.expected[i].Line++
+			}
+
+			assert.Equal(t, test.expected, migration.Up)
+			assert.Empty(t, migration.Down)
+		})
+	}
+}
+
+var blockexample = `-- +gomigrator Up
+CREATE TABLE test (id int);
+
+-- +gomigrator StatementBegin
+CREATE FUNCTION test_fn() RETURNS trigger AS '
+BEGIN
+  RETURN NEW;
+END;
+' LANGUAGE plpgsql;
+-- +gomigrator StatementEnd
+
+-- +gomigrator Down
+DROP FUNCTION test_fn;
+DROP TABLE test;
+`
+
+func TestStatementBlock(t *testing.T) {
+	migration, err := ParseMigration(strings.NewReader(blockexample))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Statement{
+		{SQL: "CREATE TABLE test (id int);", Line: 2},
+		{SQL: "CREATE FUNCTION test_fn() RETURNS trigger AS '\nBEGIN\n  RETURN NEW;\nEND;\n' LANGUAGE plpgsql;", Line: 5},
+	}, migration.Up)
+
+	assert.Equal(t, []Statement{
+		{SQL: "DROP FUNCTION test_fn;", Line: 13},
+		{SQL: "DROP TABLE test;", Line: 14},
+	}, migration.Down)
+
+	// annotations are not a part of migration
+	assert.NotContains(t, migration.UpStatements, "StatementBegin")
+
+	t.Run("unbalanced", func(t *testing.T) {
+		for _, sql := range []string{
+			"-- +gomigrator Up\n-- +gomigrator StatementBegin\nSELECT 1;\n-- +gomigrator Down\n",
+			"-- +gomigrator Up\nSELECT 1;\n-- +gomigrator StatementEnd\n",
+			"-- +gomigrator Up\n-- +gomigrator StatementBegin\n-- +gomigrator StatementBegin\n",
+		} {
+			_, err := ParseMigration(strings.NewReader(sql))
+			assert.ErrorIs(t, err, ErrStatementBlock)
+		}
+	})
+}
+
+var copyexample = "-- +gomigrator Up\n" +
+	"CREATE TABLE test (id int, name text);\n" +
+	"COPY test (id, name) FROM stdin;\n" +
+	"1\tit's; fine\n" +
+	"2\t\\N\n" +
+	"\\.\n" +
+	"copy test FROM STDIN WITH (FORMAT csv);\n" +
+	"\\.\n" +
+	"SELECT 1;\n" +
+	"-- +gomigrator Down\n" +
+	"DROP TABLE test;\n"
+
+func TestCopyFromStdin(t *testing.T) {
+	migration, err := ParseMigration(strings.NewReader(copyexample))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Statement{
+		{SQL: "CREATE TABLE test (id int, name text);", Line: 2},
+		{SQL: "COPY test (id, name) FROM stdin;", Line: 3, CopyData: []byte("1\tit's; fine\n2\t\\N\n")},
+		{SQL: "copy test FROM STDIN WITH (FORMAT csv);", Line: 7, CopyData: []byte{}},
+		{SQL: "SELECT 1;", Line: 9},
+	}, migration.Up)
+
+	// COPY to file is a usual statement
+	migration, err = ParseMigration(strings.NewReader("-- +gomigrator Up\nCOPY test TO STDOUT;\nSELECT 1;\n"))
+	assert.NoError(t, err)
+	assert.Len(t, migration.Up, 2)
+
+	t.Run("not terminated", func(t *testing.T) {
+		for _, sql := range []string{
+			"-- +gomigrator Up\nCOPY test FROM stdin;\n1\n-- +gomigrator Down\n",
+			"-- +gomigrator Up\nCOPY test FROM stdin;\n1\n",
+			"-- +gomigrator Up\nCOPY test FROM stdin",
+		} {
+			_, err := ParseMigration(strings.NewReader(sql))
+			assert.ErrorIs(t, err, ErrCopyData)
+		}
+	})
+}
@@ -2,7 +2,6 @@ package parser
 
 import (
 	"bufio"
-	"bytes"
 	"errors"
 	"io"
 	"strings"
@@ -11,11 +10,37 @@ import (
 type ParsedMigration struct {
 	UpStatements   string
 	DownStatements string
+
+	// Up and Down are statements of UpStatements and DownStatements
+	// split to execute them one by one.
+	Up   []Statement
+	Down []Statement
+
+	// NoTransaction is set by "-- +gomigrator NO TRANSACTION" annotation,
+	// such migration is executed outside of transaction
+	// (e.g. for CREATE INDEX CONCURRENTLY).
+	NoTransaction bool
+}
+
+// Statement is a single SQL statement of migration.
+type Statement struct {
+	SQL string
+
+	// Line number in migration file where statement begins (starting from 1)
+	Line int
+
+	// Rows of "COPY ... FROM STDIN" statement placed after it up to "\." line
+	// like in pg_dump output (nil for other statements)
+	CopyData []byte
 }
 
 var prefix = "-- +gomigrator"
 
-var ErrIncorrectTemplate = errors.New("incorrect sql-migration template")
+var (
+	ErrIncorrectTemplate = errors.New("incorrect sql-migration template")
+	ErrStatementBlock    = errors.New("unbalanced StatementBegin/StatementEnd annotations")
+	ErrCopyData          = errors.New(`data of COPY FROM STDIN isn't terminated by "\." line`)
+)
 
 func ParseMigration(r io.ReadSeeker) (*ParsedMigration, error) {
 	p := &ParsedMigration{}
@@ -25,25 +50,57 @@ func ParseMigration(r io.ReadSeeker) (*ParsedMigration, error) {
 		return nil, err
 	}
 
-	var buf bytes.Buffer
 	scanner := bufio.NewScanner(r)
 	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
 
-	var direction string
+	var (
+		direction string
+		split     *splitter
+		lineNum   int
+	)
+
+	// save statements of finished direction
+	finish := func() error {
+		if split == nil {
+			return nil
+		}
+
+		statements, err := split.finish()
+		if err != nil {
+			return err
+		}
+
+		if direction == "up" {
+			p.Up = append(p.Up, statements...)
+		} else {
+			p.Down = append(p.Down, statements...)
+		}
+
+		return nil
+	}
 
 	for scanner.Scan() {
 		line := scanner.Text()
+		lineNum++
 
-		if strings.HasPrefix(line, prefix+" Up") {
-			direction = "up"
+		// may be placed anywhere (usually before Up)
+		if strings.HasPrefix(line, prefix+" NO TRANSACTION") {
+			p.NoTransaction = true
+			continue
 		}
 
-		if strings.HasPrefix(line, prefix+" Down") {
-			if direction != "" {
-				buf.Reset()
+		if strings.HasPrefix(line, prefix+" Up") || strings.HasPrefix(line, prefix+" Down") {
+			if err := finish(); err != nil {
+				return nil, err
+			}
+
+			direction = "up"
+			if strings.HasPrefix(line, prefix+" Down") {
+				direction = "down"
 			}
 
-			direction = "down"
+			split = &splitter{}
+			continue
 		}
 
 		// if no direction found, terminate
@@ -51,18 +108,36 @@ func ParseMigration(r io.ReadSeeker) (*ParsedMigration, error) {
 			return nil, ErrIncorrectTemplate
 		}
 
-		if !strings.HasPrefix(line, "-- +") {
-			if _, err := buf.WriteString(line + "\n"); err != nil {
+		switch {
+		case strings.HasPrefix(line, prefix+" StatementBegin"):
+			if err := split.begin(); err != nil {
+				return nil, err
+			}
+			continue
+		case strings.HasPrefix(line, prefix+" StatementEnd"):
+			if err := split.end(); err != nil {
 				return nil, err
 			}
+			continue
+		case strings.HasPrefix(line, "-- +"):
+			continue
 		}
 
 		if direction == "up" {
-			p.UpStatements += buf.String()
+			p.UpStatements += line + "\n"
 		} else {
-			p.DownStatements += buf.String()
+			p.DownStatements += line + "\n"
 		}
-		buf.Reset()
+
+		split.writeLine(line, lineNum)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := finish(); err != nil {
+		return nil, err
 	}
 
 	return p, nil
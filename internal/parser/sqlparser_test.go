@@ -70,3 +70,21 @@ func TestParser(t *testing.T) {
 		})
 	}
 }
+
+func TestParserNoTransaction(t *testing.T) {
+	migration, err := ParseMigration(strings.NewReader(sqlexample))
+	assert.NoError(t, err)
+	assert.False(t, migration.NoTransaction)
+
+	sql := "-- +gomigrator NO TRANSACTION\n" +
+		"-- +gomigrator Up\n" +
+		"CREATE INDEX CONCURRENTLY test_idx ON test (test);\n" +
+		"-- +gomigrator Down\n" +
+		"DROP INDEX CONCURRENTLY test_idx;\n"
+
+	migration, err = ParseMigration(strings.NewReader(sql))
+	assert.NoError(t, err)
+	assert.True(t, migration.NoTransaction)
+	assert.Equal(t, "CREATE INDEX CONCURRENTLY test_idx ON test (test);\n", migration.UpStatements)
+	assert.Equal(t, "DROP INDEX CONCURRENTLY test_idx;\n", migration.DownStatements)
+}
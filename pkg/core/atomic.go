@@ -0,0 +1,86 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/XanderKon/sql-migrator-otus/internal/database"
+)
+
+var ErrAtomicNoTransaction = errors.New("migration without transaction can't be run in atomic mode")
+
+// migration with direction of run.
+type step struct {
+	migr *Migration
+	up   bool
+}
+
+func newSteps(migrations Migrations, up bool) []step {
+	steps := make([]step, 0, len(migrations))
+	for _, migr := range migrations {
+		steps = append(steps, step{migr, up})
+	}
+
+	return steps
+}
+
+// run all migrations in a single transaction. Intermediate states
+// (applying, error) are not saved: the whole batch is rolled back on failure.
+func (m *Migrate) runAtomic(ctx context.Context, result *Result, steps []step) error {
+	if len(steps) == 0 {
+		return nil
+	}
+
+	for _, st := range steps {
+		if st.migr.NoTransaction {
+			return fmt.Errorf("%w: %d (%s)", ErrAtomicNoTransaction, st.migr.Version, st.migr.Source)
+		}
+	}
+
+	batch := make([]*database.Migration, 0, len(steps))
+	results := make([]*MigrationResult, 0, len(steps))
+
+	for _, st := range steps {
+		res := newMigrationResult(st.migr, st.up)
+		m.beforeMigration(ctx, st.migr, res.Direction)
+
+		// nil record deletes version on rollback
+		var record *database.ListInfo
+		if st.up {
+			record = &database.ListInfo{
+				Version:   st.migr.Version,
+				Name:      st.migr.Source,
+				State:     database.StateApplied,
+				StartedAt: res.StartedAt,
+				Checksum:  st.migr.Checksum,
+			}
+		}
+
+		batch = append(batch, st.migr.driverMigration(st.up, record))
+		results = append(results, res)
+	}
+
+	err := m.driver.Run(ctx, batch...)
+	if err != nil {
+		err = fmt.Errorf("can't execute migrations in a single transaction: %w", err)
+	}
+
+	// all migrations of batch share the outcome
+	for i, res := range results {
+		res.Duration = time.Since(res.StartedAt)
+		res.Err = err
+		result.Migrations = append(result.Migrations, res)
+
+		if err != nil {
+			m.onError(ctx, steps[i].migr, res)
+			continue
+		}
+
+		m.afterMigration(ctx, steps[i].migr, res)
+		m.printSuccess(steps[i].migr, steps[i].up)
+	}
+
+	return err
+}
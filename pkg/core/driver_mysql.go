@@ -0,0 +1,8 @@
+//go:build mysql
+// +build mysql
+
+package core
+
+import (
+	_ "github.com/XanderKon/sql-migrator-otus/internal/database/mysql" // add mysql support.
+)
@@ -0,0 +1,8 @@
+//go:build sqlite
+// +build sqlite
+
+package core
+
+import (
+	_ "github.com/XanderKon/sql-migrator-otus/internal/database/sqlite" // add sqlite support.
+)
@@ -0,0 +1,75 @@
+package core
+
+import "context"
+
+// Hook is notified about migrations run, e.g. for audit logging,
+// notifications or metrics. Hooks are called by Up, UpTo, Down, DownTo,
+// Goto, Steps and Redo while the DB is locked (but not in DryRun mode)
+// and can't abort the run.
+type Hook interface {
+	// BeforeAll is called once before calculating and running migrations.
+	BeforeAll(ctx context.Context)
+
+	// BeforeMigration is called right before each migration. In Atomic mode
+	// it's called for all migrations of the batch before the batch is run.
+	BeforeMigration(ctx context.Context, migr *Migration, direction Direction)
+
+	// AfterMigration is called after each successful migration. In Atomic mode
+	// it's called for all migrations after the whole batch is committed.
+	AfterMigration(ctx context.Context, migr *Migration, res *MigrationResult)
+
+	// OnError is called instead of AfterMigration if migration is failed (res.Err).
+	// In Atomic mode every migration of the failed batch is reported.
+	OnError(ctx context.Context, migr *Migration, res *MigrationResult)
+
+	// AfterAll is called once after the run with all executed migrations
+	// and the final error (nil if success).
+	AfterAll(ctx context.Context, result *Result, err error)
+}
+
+// NopHook does nothing. It can be embedded to implement only needed methods of Hook.
+type NopHook struct{}
+
+func (NopHook) BeforeAll(context.Context) {}
+
+func (NopHook) BeforeMigration(context.Context, *Migration, Direction) {}
+
+func (NopHook) AfterMigration(context.Context, *Migration, *MigrationResult) {}
+
+func (NopHook) OnError(context.Context, *Migration, *MigrationResult) {}
+
+func (NopHook) AfterAll(context.Context, *Result, error) {}
+
+func (m *Migrate) beforeAll(ctx context.Context) {
+	for _, hook := range m.Hooks {
+		hook.BeforeAll(ctx)
+	}
+}
+
+func (m *Migrate) beforeMigration(ctx context.Context, migr *Migration, direction Direction) {
+	for _, hook := range m.Hooks {
+		hook.BeforeMigration(ctx, migr, direction)
+	}
+}
+
+func (m *Migrate) afterMigration(ctx context.Context, migr *Migration, res *MigrationResult) {
+	for _, hook := range m.Hooks {
+		hook.AfterMigration(ctx, migr, res)
+	}
+}
+
+// ctx may be already canceled, but hooks still should be able to report the error.
+func (m *Migrate) onError(ctx context.Context, migr *Migration, res *MigrationResult) {
+	for _, hook := range m.Hooks {
+		hook.OnError(context.WithoutCancel(ctx), migr, res)
+	}
+}
+
+// call AfterAll hooks and return passed err as is.
+func (m *Migrate) afterAll(ctx context.Context, result *Result, err error) error {
+	for _, hook := range m.Hooks {
+		hook.AfterAll(context.WithoutCancel(ctx), result, err)
+	}
+
+	return err
+}
@@ -1,19 +1,20 @@
 package core
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
-	"net/http"
-	"path"
+	"os"
 	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/XanderKon/sql-migrator-otus/internal/database"
 	_ "github.com/XanderKon/sql-migrator-otus/internal/database/postgres" // add pg support.
-	"github.com/XanderKon/sql-migrator-otus/internal/logger"
 	"github.com/XanderKon/sql-migrator-otus/internal/parser"
 )
 
@@ -21,40 +22,162 @@ var (
 	ErrNoCurrentVersion      = errors.New("no current version found. Please check your DB state")
 	ErrNoAvailableMigrations = errors.New("no available migrations found")
 	ErrAlreadyUpToDate       = errors.New("already up to date")
+	ErrDuplicateVersion      = errors.New("duplicate migration version")
+	ErrVersionNotFound       = errors.New("no migration found with version")
+	ErrNotEnoughMigrations   = errors.New("not enough migrations")
+	ErrZeroSteps             = errors.New("number of steps should not be zero")
+	ErrMissingMigrations     = errors.New("found not applied migrations older than the current version")
+	ErrChecksumMismatch      = errors.New("found applied migrations changed after applying")
 )
 
 const DefaultTableName = "migrations"
 
+// how often migrator tries to acquire the lock during lockTimeout
+// (the interval is doubled after each attempt up to the max one).
+const (
+	defaultLockRetryInterval    = 100 * time.Millisecond
+	defaultLockMaxRetryInterval = 5 * time.Second
+)
+
+// Direction of migrations run.
+type Direction string
+
+const (
+	DirectionUp   Direction = "up"
+	DirectionDown Direction = "down"
+)
+
 type Migrate struct {
-	Log *logger.Logger
+	Log Logger
+
+	// DryRun only prints migrations which would be executed,
+	// without locking and changing the DB. Set it by WithDryRun,
+	// so New doesn't create or upgrade migrations table.
+	DryRun bool
+
+	// AllowMissing allows to apply pending migrations with version lower than
+	// the current one (e.g. merged from another branch later).
+	AllowMissing bool
+
+	// IgnoreChecksums allows to apply new migrations even if files of
+	// already applied ones were changed (mismatches are just logged).
+	IgnoreChecksums bool
 
-	driver    database.Driver
-	tablename string
-	dir       string
+	// Atomic runs all selected migrations (with updates of migrations table)
+	// in a single transaction: either all of them are applied or nothing.
+	// Migrations with NoTransaction can't be run in this mode.
+	// Hooks are called for the batch as a whole (see Hook.BeforeMigration).
+	Atomic bool
+
+	// Hooks are called around migrations run (see Hook).
+	Hooks []Hook
+
+	driver      database.Driver
+	tablename   string
+	fsys        fs.FS
+	lockTimeout time.Duration
+
+	// backoff of lock attempts
+	lockRetryInterval    time.Duration
+	lockMaxRetryInterval time.Duration
+
+	// the table isn't prepared in DryRun mode, so it may be missing
+	unprepared bool
 }
 
 // Migrations slice.
 type Migrations []*Migration
 
-func NewMigrator(dsn string, tableName string, dir string) (*Migrate, error) {
-	if tableName == "" {
-		tableName = DefaultTableName
+// contains reports whether migration with version is in the slice.
+func (ms Migrations) contains(version int64) bool {
+	return slices.ContainsFunc(ms, func(migr *Migration) bool {
+		return migr.Version == version
+	})
+}
+
+// New creates migrator configured by options, e.g.:
+//
+//	migrator, err := core.New(
+//		core.WithDB(db, "postgres"),
+//		core.WithFS(fsys),
+//		core.WithLogger(logger),
+//	)
+func New(opts ...Option) (*Migrate, error) {
+	o := &options{
+		tableName: DefaultTableName,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.fsys == nil {
+		o.fsys = os.DirFS(DefaultDir)
+	}
+
+	if o.tableName == "" {
+		o.tableName = DefaultTableName
+	}
+
+	// full name (for messages)
+	tableName := o.tableName
+	if o.schema != "" {
+		tableName = o.schema + "." + tableName
 	}
 
 	// get driver
-	driver, err := database.Open(dsn, tableName)
+	var (
+		driver database.Driver
+		err    error
+	)
+
+	cfg := database.Config{
+		TableName:  o.tableName,
+		Schema:     o.schema,
+		SearchPath: o.searchPath,
+		LockID:     o.lockID,
+		Log:        o.log,
+	}
+
+	switch {
+	case o.driver != nil:
+		driver = o.driver
+	case o.db != nil:
+		driver, err = database.OpenWithInstance(o.driverName, o.db, cfg)
+	case o.dsn != "":
+		driver, err = database.Open(o.dsn, cfg)
+	default:
+		err = ErrNoConnection
+	}
+
 	if err != nil {
 		return nil, fmt.Errorf("can't get driver: %w", err)
 	}
 
 	migr := &Migrate{
-		driver:    driver,
-		tablename: tableName,
-		dir:       dir,
+		Log:             o.log,
+		DryRun:          o.dryRun,
+		AllowMissing:    o.allowMissing,
+		IgnoreChecksums: o.ignoreChecksums,
+		Atomic:          o.atomic,
+		Hooks:           o.hooks,
+		driver:          driver,
+		tablename:       tableName,
+		fsys:            o.fsys,
+		lockTimeout:     o.lockTimeout,
+		unprepared:      o.dryRun,
+
+		lockRetryInterval:    defaultLockRetryInterval,
+		lockMaxRetryInterval: defaultLockMaxRetryInterval,
+	}
+
+	// DryRun doesn't touch migrations table
+	if o.dryRun {
+		return migr, nil
 	}
 
 	// create table if does not exist
-	err = migr.prepareDatabase()
+	err = migr.prepareDatabase(context.Background())
 
 	if err != nil {
 		return nil, fmt.Errorf("can't initialize table: %w", err)
@@ -63,87 +186,326 @@ func NewMigrator(dsn string, tableName string, dir string) (*Migrate, error) {
 	return migr, nil
 }
 
-func (m *Migrate) Up() error {
-	if err := m.lock(); err != nil {
-		return err
+// NewMigrator creates migrator for migrations from dir folder.
+func NewMigrator(dsn string, tableName string, dir string) (*Migrate, error) {
+	return New(WithDSN(dsn), WithTableName(tableName), WithDir(dir))
+}
+
+// NewMigratorFS creates migrator for migrations from root of fsys, e.g. embed.FS:
+//
+//	//go:embed migrations/*.sql
+//	var migrations embed.FS
+//
+//	fsys, _ := fs.Sub(migrations, "migrations")
+//	migrator, err := core.NewMigratorFS(dsn, "migrations", fsys)
+func NewMigratorFS(dsn string, tableName string, fsys fs.FS) (*Migrate, error) {
+	return New(WithDSN(dsn), WithTableName(tableName), WithFS(fsys))
+}
+
+// Up applies all available migrations.
+func (m *Migrate) Up() (*Result, error) {
+	return m.UpContext(context.Background())
+}
+
+// UpContext is like Up, but can be canceled by ctx.
+func (m *Migrate) UpContext(ctx context.Context) (*Result, error) {
+	return m.migrate(ctx, true, -1, 0)
+}
+
+// UpTo applies available migrations up to (and including) version.
+func (m *Migrate) UpTo(version int64) (*Result, error) {
+	return m.UpToContext(context.Background(), version)
+}
+
+// UpToContext is like UpTo, but can be canceled by ctx.
+func (m *Migrate) UpToContext(ctx context.Context, version int64) (*Result, error) {
+	if err := m.checkVersion(version); err != nil {
+		return &Result{}, err
+	}
+
+	return m.migrate(ctx, true, version, 0)
+}
+
+// Down rolls back the latest applied migration.
+func (m *Migrate) Down() (*Result, error) {
+	return m.DownContext(context.Background())
+}
+
+// DownContext is like Down, but can be canceled by ctx.
+func (m *Migrate) DownContext(ctx context.Context) (*Result, error) {
+	return m.migrate(ctx, false, -1, 1)
+}
+
+// DownTo rolls back all applied migrations with version greater than passed one.
+// Use version 0 to roll back everything.
+func (m *Migrate) DownTo(version int64) (*Result, error) {
+	return m.DownToContext(context.Background(), version)
+}
+
+// DownToContext is like DownTo, but can be canceled by ctx.
+func (m *Migrate) DownToContext(ctx context.Context, version int64) (*Result, error) {
+	if err := m.checkVersion(version); err != nil {
+		return &Result{}, err
+	}
+
+	return m.migrate(ctx, false, version, 0)
+}
+
+// Goto migrates the DB to the passed version in any direction:
+// rolls back all applied migrations newer than version and then applies
+// all pending migrations up to (and including) version.
+func (m *Migrate) Goto(version int64) (*Result, error) {
+	return m.GotoContext(context.Background(), version)
+}
+
+// GotoContext is like Goto, but can be canceled by ctx.
+func (m *Migrate) GotoContext(ctx context.Context, version int64) (*Result, error) {
+	result := &Result{}
+
+	if err := m.checkVersion(version); err != nil {
+		return result, err
+	}
+
+	if m.DryRun {
+		return result, m.gotoPlan(ctx, version)
+	}
+
+	if err := m.lock(ctx); err != nil {
+		return result, err
 	}
 
-	migrations, err := m.migrationsForRun(true, 0)
+	m.beforeAll(ctx)
+
+	down, up, err := m.migrationsForGoto(ctx, version)
 	if err != nil {
-		return m.unlock(err)
+		return result, m.unlock(ctx, m.afterAll(ctx, result, err))
 	}
 
-	for _, migr := range migrations {
-		if err := m.driver.Run(strings.NewReader(migr.UpSQL)); err != nil {
-			return m.unlock(fmt.Errorf("can't execute migration with version %d: %w", migr.Version, err))
-		}
+	steps := append(newSteps(down, false), newSteps(up, true)...)
 
-		// set version if success
-		m.setVersion(migr.Version)
-		m.printLog(fmt.Sprintf("Migration %d successfully applied!", migr.Version))
+	return result, m.unlock(ctx, m.afterAll(ctx, result, m.runSteps(ctx, result, steps)))
+}
+
+// prepare migrations to rollback and to apply for reaching passed version.
+func (m *Migrate) migrationsForGoto(ctx context.Context, version int64) (Migrations, Migrations, error) {
+	down, err := m.migrationsForRun(ctx, false, version, 0)
+	if err != nil && !errors.Is(err, ErrAlreadyUpToDate) {
+		return nil, nil, err
+	}
+
+	// rolled back migrations aren't applied anymore, so they can't make older ones missing
+	up, err := m.migrationsToApply(ctx, version, down)
+	if err != nil && !errors.Is(err, ErrAlreadyUpToDate) {
+		return nil, nil, err
 	}
 
-	return m.unlock(nil)
+	if len(down) == 0 && len(up) == 0 {
+		return nil, nil, ErrAlreadyUpToDate
+	}
+
+	return down, up, nil
 }
 
-func (m *Migrate) Down() error {
-	if err := m.lock(); err != nil {
-		return err
+// Steps applies exactly n pending migrations if n > 0
+// or rolls back exactly -n applied migrations if n < 0.
+func (m *Migrate) Steps(n int) (*Result, error) {
+	return m.StepsContext(context.Background(), n)
+}
+
+// StepsContext is like Steps, but can be canceled by ctx.
+func (m *Migrate) StepsContext(ctx context.Context, n int) (*Result, error) {
+	if n == 0 {
+		return &Result{}, ErrZeroSteps
+	}
+
+	if n > 0 {
+		return m.migrate(ctx, true, -1, n)
 	}
 
-	migrations, err := m.migrationsForRun(false, 1)
+	return m.migrate(ctx, false, -1, -n)
+}
+
+// lock DB, calculate migrations and run them.
+func (m *Migrate) migrate(ctx context.Context, up bool, target int64, limit int) (*Result, error) {
+	result := &Result{}
+
+	if m.DryRun {
+		migrations, err := m.migrationsForRun(ctx, up, target, limit)
+		if err != nil {
+			return result, err
+		}
+
+		m.printPlan(migrations, up)
+		return result, nil
+	}
+
+	if err := m.lock(ctx); err != nil {
+		return result, err
+	}
+
+	m.beforeAll(ctx)
+
+	migrations, err := m.migrationsForRun(ctx, up, target, limit)
 	if err != nil {
-		return m.unlock(err)
+		return result, m.unlock(ctx, m.afterAll(ctx, result, err))
 	}
 
-	for _, migr := range migrations {
-		if err := m.driver.Run(strings.NewReader(migr.DownSQL)); err != nil {
-			return m.unlock(fmt.Errorf("can't rollback migration with version %d: %w", migr.Version, err))
+	return result, m.unlock(ctx, m.afterAll(ctx, result, m.runSteps(ctx, result, newSteps(migrations, up))))
+}
+
+// run migrations one by one (or all together in Atomic mode), update versions and collect results.
+func (m *Migrate) runSteps(ctx context.Context, result *Result, steps []step) error {
+	if m.Atomic {
+		return m.runAtomic(ctx, result, steps)
+	}
+
+	for _, st := range steps {
+		migr, up := st.migr, st.up
+
+		res := newMigrationResult(migr, up)
+		m.beforeMigration(ctx, migr, res.Direction)
+
+		var err error
+		if up {
+			err = m.applyMigration(ctx, migr)
+		} else {
+			err = m.rollbackMigration(ctx, migr)
 		}
 
-		// delete version if success
-		m.deleteVersion(migr.Version)
-		m.printLog(fmt.Sprintf("Migration %d successfully rollback!", migr.Version))
+		res.Duration = time.Since(res.StartedAt)
+		res.Err = err
+		result.Migrations = append(result.Migrations, res)
+
+		if err != nil {
+			m.onError(ctx, migr, res)
+			return err
+		}
+
+		m.afterMigration(ctx, migr, res)
+		m.printSuccess(migr, up)
 	}
 
-	return m.unlock(nil)
+	return nil
 }
 
-func (m *Migrate) Redo() error {
-	if err := m.lock(); err != nil {
+func (m *Migrate) printSuccess(migr *Migration, up bool) {
+	if up {
+		m.printLog(fmt.Sprintf("Migration %d successfully applied!", migr.Version))
+	} else {
+		m.printLog(fmt.Sprintf("Migration %d successfully rollback!", migr.Version))
+	}
+}
+
+// apply migration and save its state before and after run.
+func (m *Migrate) applyMigration(ctx context.Context, migr *Migration) error {
+	info := &database.ListInfo{
+		Version:   migr.Version,
+		Name:      migr.Source,
+		State:     database.StateApplying,
+		StartedAt: time.Now(),
+		Checksum:  migr.Checksum,
+	}
+
+	// mark migration as running
+	if err := m.setVersion(ctx, info); err != nil {
 		return err
 	}
 
-	currentMigration, err := m.currentMigration()
+	// version is saved in the same transaction with migration
+	applied := *info
+	applied.State = database.StateApplied
+
+	runErr := migr.run(ctx, m.driver, true, &applied)
+	if runErr != nil {
+		info.Finish()
+		info.State = database.StateError
+		info.LastError = runErr.Error()
+
+		// migration is rolled back, the state is saved separately
+		// (even if the run is canceled, so it doesn't stay "applying")
+		if err := m.setVersion(context.WithoutCancel(ctx), info); err != nil {
+			runErr = fmt.Errorf("%w. Additional err: %w", runErr, err)
+		}
+
+		return fmt.Errorf("can't execute migration with version %d: %w", migr.Version, runErr)
+	}
+
+	return nil
+}
+
+// rollback migration and delete its version (or save the reason of failure).
+func (m *Migrate) rollbackMigration(ctx context.Context, migr *Migration) error {
+	// version is deleted in the same transaction with migration
+	runErr := migr.run(ctx, m.driver, false, nil)
+	if runErr == nil {
+		return nil
+	}
+
+	// migration is still applied, just save the error (even if the run is canceled)
+	ctx = context.WithoutCancel(ctx)
+
+	info, err := m.versionInfo(ctx, migr.Version)
+	if err == nil {
+		info.LastError = runErr.Error()
+		err = m.setVersion(ctx, info)
+	}
+
+	if err != nil {
+		runErr = fmt.Errorf("%w. Additional err: %w", runErr, err)
+	}
+
+	return fmt.Errorf("can't rollback migration with version %d: %w", migr.Version, runErr)
+}
+
+// Redo rolls back the latest applied migration and applies it again.
+func (m *Migrate) Redo() (*Result, error) {
+	return m.RedoContext(context.Background())
+}
+
+// RedoContext is like Redo, but can be canceled by ctx.
+func (m *Migrate) RedoContext(ctx context.Context) (*Result, error) {
+	result := &Result{}
+
+	if m.DryRun {
+		return result, m.redoPlan(ctx)
+	}
+
+	if err := m.lock(ctx); err != nil {
+		return result, err
+	}
+
+	m.beforeAll(ctx)
+
+	currentMigration, err := m.currentMigration(ctx)
 	if errors.Is(err, ErrNoCurrentVersion) {
 		m.printLog(err.Error())
-		return m.unlock(nil)
+		return result, m.unlock(ctx, m.afterAll(ctx, result, nil))
 	}
 
-	// rollback it first
-	if err := m.driver.Run(strings.NewReader(currentMigration.DownSQL)); err != nil {
-		return m.unlock(fmt.Errorf("can't rollback migration with version %d: %w", currentMigration.Version, err))
+	if err != nil {
+		return result, m.unlock(ctx, m.afterAll(ctx, result, err))
 	}
-	m.deleteVersion(currentMigration.Version)
-	m.printLog(fmt.Sprintf("Migration %d successfully rollback!", currentMigration.Version))
 
-	// ...and then run to up
-	if err := m.driver.Run(strings.NewReader(currentMigration.UpSQL)); err != nil {
-		return m.unlock(fmt.Errorf("can't execute migration with version %d: %w", currentMigration.Version, err))
-	}
-	m.setVersion(currentMigration.Version)
-	m.printLog(fmt.Sprintf("Migration %d successfully applied!", currentMigration.Version))
+	// rollback it first and then run to up
+	steps := []step{{currentMigration, false}, {currentMigration, true}}
+	err = m.runSteps(ctx, result, steps)
 
-	return m.unlock(nil)
+	return result, m.unlock(ctx, m.afterAll(ctx, result, err))
 }
 
+// Dbversion returns version of the latest applied migration.
 func (m *Migrate) Dbversion() (int64, error) {
-	if err := m.lock(); err != nil {
+	return m.DbversionContext(context.Background())
+}
+
+// DbversionContext is like Dbversion, but can be canceled by ctx.
+func (m *Migrate) DbversionContext(ctx context.Context) (int64, error) {
+	if err := m.lock(ctx); err != nil {
 		return -1, err
 	}
-	defer m.unlock(nil)
+	defer m.unlock(ctx, nil)
 
-	currentMigration, err := m.currentMigration()
+	currentMigration, err := m.currentMigration(ctx)
 	if err != nil {
 		return -1, ErrNoCurrentVersion
 	}
@@ -152,50 +514,117 @@ func (m *Migrate) Dbversion() (int64, error) {
 	return currentMigration.Version, nil
 }
 
+// Plan returns migrations which would be executed to migrate the DB
+// in passed direction up to target version (-1 -- without target,
+// i.e. all pending migrations for up and all applied for down).
+// It doesn't lock and doesn't change the DB.
+func (m *Migrate) Plan(direction Direction, target int64) (Migrations, error) {
+	return m.PlanContext(context.Background(), direction, target)
+}
+
+// PlanContext is like Plan, but can be canceled by ctx.
+func (m *Migrate) PlanContext(ctx context.Context, direction Direction, target int64) (Migrations, error) {
+	if target >= 0 {
+		if err := m.checkVersion(target); err != nil {
+			return make(Migrations, 0), err
+		}
+	}
+
+	return m.migrationsForRun(ctx, direction == DirectionUp, target, 0)
+}
+
 // close migrator API
 // just close DB connection in our case.
 func (m *Migrate) Close() error {
 	return m.driver.Close()
 }
 
-// get mapped list of migrations.
+// get mapped list of all migrations: applied (in any state) and pending ones
+// from migrations folder and applied ones which files are missing.
 func (m *Migrate) FullList() ([]*Migration, error) {
+	return m.FullListContext(context.Background())
+}
+
+// FullListContext is like FullList, but can be canceled by ctx.
+func (m *Migrate) FullListContext(ctx context.Context) ([]*Migration, error) {
 	migrations := make([]*Migration, 0)
 
-	if err := m.lock(); err != nil {
+	if err := m.lock(ctx); err != nil {
 		return migrations, err
 	}
 
-	list, err := m.driver.List()
+	list, err := m.driver.List(ctx)
 	if err != nil {
-		return migrations, m.unlock(fmt.Errorf("can't get full list of applied migraions: %w", err))
+		return migrations, m.unlock(ctx, fmt.Errorf("can't get full list of applied migraions: %w", err))
 	}
 
 	// get available migrations
 	availableMigrations, err := m.findAvailableMigrations()
 	if err != nil {
-		return migrations, m.unlock(err)
+		return migrations, m.unlock(ctx, err)
+	}
+
+	// the newest applied version
+	var newest int64 = -1
+	for _, info := range list {
+		if info.State == database.StateApplied && info.Version > newest {
+			newest = info.Version
+		}
 	}
 
 	// mapping
-	for _, migr := range list {
-		migration, err := m.getMigrationByVersion(availableMigrations, migr.Version)
+	for _, migration := range availableMigrations {
+		migration.State = StatePending
+		if migration.Version < newest {
+			migration.State = StateOutOfOrder
+		}
+
+		migrations = append(migrations, migration)
+	}
+
+	for _, info := range list {
+		migration, err := m.getMigrationByVersion(availableMigrations, info.Version)
 		if err == nil {
-			// add applied_at time.
-			migration.AppliedAt = migr.AppliedAt
-			migrations = append(migrations, migration)
+			// add state from DB.
+			migration.setInfo(info)
+			continue
 		}
+
+		// file of migration was deleted
+		migration = &Migration{
+			Version: info.Version,
+			Source:  info.Name,
+		}
+		migration.setInfo(info)
+		migration.State = StateOrphaned
+
+		migrations = append(migrations, migration)
 	}
 
-	m.unlock(nil)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
 
-	return migrations, nil
+	return migrations, m.unlock(ctx, nil)
 }
 
 // prepare migrations slice for next Run
 // up -- direction
+// target -- version to migrate to (-1 -- without target)
 // limit -- how many migrations should be executed (0 -- without limit).
-func (m *Migrate) migrationsForRun(up bool, limit int) (Migrations, error) {
+func (m *Migrate) migrationsForRun(ctx context.Context, up bool, target int64, limit int) (Migrations, error) {
+	return m.selectMigrations(ctx, up, target, limit, nil)
+}
+
+// prepare migrations to apply up to target after rollback of rolledBack migrations.
+func (m *Migrate) migrationsToApply(ctx context.Context, target int64, rolledBack Migrations) (Migrations, error) {
+	return m.selectMigrations(ctx, true, target, 0, rolledBack)
+}
+
+// migrationsForRun with migrations from rolledBack considered as not applied.
+func (m *Migrate) selectMigrations(
+	ctx context.Context, up bool, target int64, limit int, rolledBack Migrations,
+) (Migrations, error) {
 	// get available migrations
 	availableMigrations, err := m.findAvailableMigrations()
 	if err != nil {
@@ -208,14 +637,24 @@ func (m *Migrate) migrationsForRun(up bool, limit int) (Migrations, error) {
 	}
 
 	// get list of applied migrations
-	lofm, err := m.list()
+	lofm, err := m.list(ctx)
 	if err != nil {
 		return make(Migrations, 0), err
 	}
 
 	appliedVersions := []int64{}
 	for _, ap := range lofm {
-		appliedVersions = append(appliedVersions, ap.Version)
+		// failed and running migrations are not applied
+		if ap.State == database.StateApplied && !rolledBack.contains(ap.Version) {
+			appliedVersions = append(appliedVersions, ap.Version)
+		}
+	}
+
+	// refuse to go up if applied migrations were changed
+	if up {
+		if err := m.checkChecksums(availableMigrations, lofm); err != nil {
+			return make(Migrations, 0), err
+		}
 	}
 
 	// if we go down and don't have any applied migrations - do nothing
@@ -223,11 +662,6 @@ func (m *Migrate) migrationsForRun(up bool, limit int) (Migrations, error) {
 		return make(Migrations, 0), ErrAlreadyUpToDate
 	}
 
-	// if we go up and don't have any applied migrations - run all of then
-	if len(appliedVersions) == 0 && up {
-		return availableMigrations, nil
-	}
-
 	var migrationsForRun Migrations
 
 	// calc the difference between them
@@ -239,11 +673,24 @@ func (m *Migrate) migrationsForRun(up bool, limit int) (Migrations, error) {
 
 		// filter them
 		for _, migr := range availableMigrations {
-			if migr.Version <= appliedVersions[len(appliedVersions)-1] {
+			// if it isn't applied - skip
+			if !slices.Contains(appliedVersions, migr.Version) {
+				continue
+			}
+
+			if target < 0 || migr.Version > target {
 				migrationsForRun = append(migrationsForRun, migr)
 			}
 		}
 	} else {
+		var missing []string
+
+		// the newest applied version
+		var newest int64 = -1
+		if len(appliedVersions) > 0 {
+			newest = slices.Max(appliedVersions)
+		}
+
 		// filter them
 		for _, migr := range availableMigrations {
 			// if it already applied - skip
@@ -251,9 +698,25 @@ func (m *Migrate) migrationsForRun(up bool, limit int) (Migrations, error) {
 				continue
 			}
 
-			if migr.Version > appliedVersions[0] {
-				migrationsForRun = append(migrationsForRun, migr)
+			// skip everything behind the target
+			if target >= 0 && migr.Version > target {
+				continue
 			}
+
+			// older than the newest applied one
+			if migr.Version < newest {
+				missing = append(missing, fmt.Sprintf("%d (%s)", migr.Version, migr.Source))
+
+				if !m.AllowMissing {
+					continue
+				}
+			}
+
+			migrationsForRun = append(migrationsForRun, migr)
+		}
+
+		if len(missing) > 0 && !m.AllowMissing {
+			return make(Migrations, 0), fmt.Errorf("%w: %s", ErrMissingMigrations, strings.Join(missing, ", "))
 		}
 	}
 
@@ -262,6 +725,12 @@ func (m *Migrate) migrationsForRun(up bool, limit int) (Migrations, error) {
 	}
 
 	// slice target slice
+	if limit > len(migrationsForRun) {
+		return make(Migrations, 0), fmt.Errorf(
+			"%w: requested %d, but only %d can be executed", ErrNotEnoughMigrations, limit, len(migrationsForRun),
+		)
+	}
+
 	if limit > 0 {
 		migrationsForRun = migrationsForRun[0:limit]
 	}
@@ -269,7 +738,29 @@ func (m *Migrate) migrationsForRun(up bool, limit int) (Migrations, error) {
 	return migrationsForRun, nil
 }
 
-func (m *Migrate) currentMigration() (*Migration, error) {
+// check that migration with passed version exists (0 means "before the first migration").
+func (m *Migrate) checkVersion(version int64) error {
+	if version == 0 {
+		return nil
+	}
+
+	if version < 0 {
+		return fmt.Errorf("%w: %d", ErrVersionNotFound, version)
+	}
+
+	availableMigrations, err := m.findAvailableMigrations()
+	if err != nil {
+		return err
+	}
+
+	if _, err := m.getMigrationByVersion(availableMigrations, version); err != nil {
+		return fmt.Errorf("%w: %d", ErrVersionNotFound, version)
+	}
+
+	return nil
+}
+
+func (m *Migrate) currentMigration(ctx context.Context) (*Migration, error) {
 	// get available migrations.
 	availableMigrations, err := m.findAvailableMigrations()
 	if err != nil {
@@ -277,7 +768,7 @@ func (m *Migrate) currentMigration() (*Migration, error) {
 	}
 
 	// get current migration version from DB.
-	currentVersion, err := m.current()
+	currentVersion, err := m.current(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -304,20 +795,15 @@ func (m *Migrate) getMigrationByVersion(migraions Migrations, version int64) (*M
 func (m *Migrate) findAvailableMigrations() (Migrations, error) {
 	migrations := make([]*Migration, 0)
 
-	file, err := http.Dir(m.dir).Open(".")
-	if err != nil {
-		return nil, err
-	}
-
-	files, err := file.Readdir(0)
+	files, err := fs.ReadDir(m.fsys, ".")
 	if err != nil {
 		return nil, err
 	}
 
-	for _, info := range files {
-		name := info.Name()
-		if strings.HasSuffix(name, ".sql") {
-			migration, err := m.parseSQLMigration(info)
+	for _, entry := range files {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasSuffix(name, ".sql") {
+			migration, err := m.parseSQLMigration(name)
 			if err != nil {
 				return nil, err
 			}
@@ -326,6 +812,17 @@ func (m *Migrate) findAvailableMigrations() (Migrations, error) {
 		}
 	}
 
+	// add registered Go-migrations, they are compiled into the binary
+	for _, migration := range registeredGoMigrations() {
+		if existing, err := m.getMigrationByVersion(migrations, migration.Version); err == nil {
+			return nil, fmt.Errorf(
+				"%w: %d (%s and %s)", ErrDuplicateVersion, migration.Version, existing.Source, migration.Source,
+			)
+		}
+
+		migrations = append(migrations, migration)
+	}
+
 	// insure then they are sorted by version correctly
 	sort.Slice(migrations, func(i, j int) bool {
 		return migrations[i].Version < migrations[j].Version
@@ -335,39 +832,50 @@ func (m *Migrate) findAvailableMigrations() (Migrations, error) {
 }
 
 // parse SQL migration file.
-func (m *Migrate) parseSQLMigration(info fs.FileInfo) (*Migration, error) {
-	path := path.Join("./", info.Name())
-
-	file, err := http.Dir(m.dir).Open(path)
+func (m *Migrate) parseSQLMigration(name string) (*Migration, error) {
+	content, err := fs.ReadFile(m.fsys, name)
 	if err != nil {
-		return nil, fmt.Errorf("error while opening %s: %w", info.Name(), err)
+		return nil, fmt.Errorf("error while opening %s: %w", name, err)
 	}
-	defer func() { _ = file.Close() }()
 
-	if err != nil {
-		return nil, fmt.Errorf("error while opening %s: %w", info.Name(), err)
-	}
-
-	version := m.getVersionFromFileName(info.Name())
+	version := getVersionFromFileName(name)
 
 	migration := &Migration{
 		Version: version,
-		Source:  info.Name(),
+		Type:    TypeSQL,
+		Source:  name,
 	}
 
-	parsed, err := parser.ParseMigration(file)
+	parsed, err := parser.ParseMigration(bytes.NewReader(content))
 	if err != nil {
-		return nil, fmt.Errorf("error while parsing file %s: %w", info.Name(), err)
+		return nil, fmt.Errorf("error while parsing file %s: %w", name, err)
 	}
 
 	// set statements
 	migration.UpSQL = parsed.UpStatements
 	migration.DownSQL = parsed.DownStatements
+	migration.NoTransaction = parsed.NoTransaction
+	migration.upStatements = convertStatements(parsed.Up)
+	migration.downStatements = convertStatements(parsed.Down)
+	migration.Checksum = checksum(migration.UpSQL, migration.DownSQL)
 
 	return migration, nil
 }
 
-func (m *Migrate) getVersionFromFileName(filename string) int64 {
+func convertStatements(statements []parser.Statement) []database.Statement {
+	converted := make([]database.Statement, 0, len(statements))
+	for _, statement := range statements {
+		converted = append(converted, database.Statement{
+			SQL:      statement.SQL,
+			Line:     statement.Line,
+			CopyData: statement.CopyData,
+		})
+	}
+
+	return converted
+}
+
+func getVersionFromFileName(filename string) int64 {
 	version := strings.Split(filename, "_")[0]
 	i, _ := strconv.ParseInt(version, 10, 64)
 
@@ -375,12 +883,12 @@ func (m *Migrate) getVersionFromFileName(filename string) int64 {
 }
 
 // create migrations table if it doesn't exist.
-func (m *Migrate) prepareDatabase() error {
-	return m.driver.PrepareTable()
+func (m *Migrate) prepareDatabase(ctx context.Context) error {
+	return m.driver.PrepareTable(ctx)
 }
 
-func (m *Migrate) setVersion(version int64) error {
-	err := m.driver.SetVersion(version)
+func (m *Migrate) setVersion(ctx context.Context, info *database.ListInfo) error {
+	err := m.driver.SetVersion(ctx, info)
 	if err != nil {
 		return fmt.Errorf("can't set new migraion version: %w", err)
 	}
@@ -388,17 +896,29 @@ func (m *Migrate) setVersion(version int64) error {
 	return nil
 }
 
-func (m *Migrate) deleteVersion(version int64) error {
-	err := m.driver.DeleteVersion(version)
+// get saved state of migration by version.
+func (m *Migrate) versionInfo(ctx context.Context, version int64) (*database.ListInfo, error) {
+	list, err := m.list(ctx)
 	if err != nil {
-		return fmt.Errorf("can't delete migraion version: %w", err)
+		return nil, err
 	}
 
-	return nil
+	for _, info := range list {
+		if info.Version == version {
+			return info, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no saved state of migration with version %d", version)
 }
 
-func (m *Migrate) list() ([]*database.ListInfo, error) {
-	list, err := m.driver.List()
+func (m *Migrate) list(ctx context.Context) ([]*database.ListInfo, error) {
+	list, err := m.driver.List(ctx)
+	if err != nil && m.unprepared {
+		m.printLog(fmt.Sprintf("[DRY RUN] Can't read migrations table, it's considered empty: %s", err))
+		return []*database.ListInfo{}, nil
+	}
+
 	if err != nil {
 		return []*database.ListInfo{}, fmt.Errorf("can't get list of applied migraions: %w", err)
 	}
@@ -407,8 +927,13 @@ func (m *Migrate) list() ([]*database.ListInfo, error) {
 }
 
 // Get current migration version from DB driver.
-func (m *Migrate) current() (int64, error) {
-	curVersion, err := m.driver.Version()
+func (m *Migrate) current(ctx context.Context) (int64, error) {
+	curVersion, err := m.driver.Version(ctx)
+	if err != nil && m.unprepared {
+		m.printLog(fmt.Sprintf("[DRY RUN] Can't read migrations table, it's considered empty: %s", err))
+		return -1, nil
+	}
+
 	if err != nil {
 		return -1, fmt.Errorf("can't get current migration: %w", err)
 	}
@@ -416,14 +941,57 @@ func (m *Migrate) current() (int64, error) {
 	return curVersion, nil
 }
 
-// lock the driver.
-func (m *Migrate) lock() error {
-	return m.driver.Lock()
+// lock the driver (wait for lockTimeout if it's already locked).
+func (m *Migrate) lock(ctx context.Context) error {
+	deadline := time.Now().Add(m.lockTimeout)
+	interval := m.lockRetryInterval
+	waiting := false
+
+	for {
+		err := m.driver.Lock(ctx)
+		if !errors.Is(err, database.ErrLocked) {
+			return err
+		}
+
+		if !time.Now().Before(deadline) {
+			return m.lockError(ctx, err)
+		}
+
+		if !waiting {
+			m.printLog(fmt.Sprintf("Waiting for the lock up to %s...", m.lockTimeout))
+			waiting = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(min(interval, time.Until(deadline))):
+		}
+
+		// exponential backoff
+		interval = min(interval*2, m.lockMaxRetryInterval)
+	}
+}
+
+// add information about the lock holder (if driver supports it).
+func (m *Migrate) lockError(ctx context.Context, err error) error {
+	holder, ok := m.driver.(database.LockHolder)
+	if !ok {
+		return err
+	}
+
+	info, holderErr := holder.LockHolder(ctx)
+	if holderErr != nil || info == nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: held by %s", err, info)
 }
 
 // release lock and return err if exists.
-func (m *Migrate) unlock(prevError error) error {
-	if err := m.driver.Unlock(); err != nil {
+func (m *Migrate) unlock(ctx context.Context, prevError error) error {
+	// unlock even if ctx is already canceled
+	if err := m.driver.Unlock(context.WithoutCancel(ctx)); err != nil {
 		finalError := fmt.Errorf("can't unlock from database driver: %w", err)
 		if prevError != nil {
 			finalError = fmt.Errorf("%w. Additional err: %w", finalError, prevError)
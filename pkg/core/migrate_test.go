@@ -1,9 +1,24 @@
 package core
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"testing"
+	"testing/fstest"
+	"time"
 
-	_ "github.com/XanderKon/sql-migrator-otus/internal/database/stub"
+	"github.com/XanderKon/sql-migrator-otus/internal/database"
+	_ "github.com/XanderKon/sql-migrator-otus/internal/database/sqlite"
+	"github.com/XanderKon/sql-migrator-otus/internal/database/stub"
+	"github.com/XanderKon/sql-migrator-otus/internal/logger"
+	"github.com/XanderKon/sql-migrator-otus/pkg/database/memory"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -31,7 +46,890 @@ func TestFindAvailableMigrations(t *testing.T) {
 }
 
 func TestGetVersionFromFileName(t *testing.T) {
-	version := testMigrator.getVersionFromFileName("1234_test_migr.sql")
+	version := getVersionFromFileName("1234_test_migr.sql")
 	assert.NotEmpty(t, version)
 	assert.Equal(t, version, int64(1234))
 }
+
+func TestGoMigrations(t *testing.T) {
+	ctx := context.Background()
+
+	var called bool
+	up := func(_ context.Context, _ *sql.Tx) error {
+		called = true
+		return nil
+	}
+
+	AddNamedMigration("/some/path/20240120196000_go_migration.go", up, nil)
+	defer delete(registeredMigrations, 20240120196000)
+
+	t.Run("interleave with sql", func(t *testing.T) {
+		migrations, err := testMigrator.findAvailableMigrations()
+		assert.NoError(t, err)
+		assert.Len(t, migrations, 4)
+
+		m := migrations[1]
+		assert.Equal(t, int64(20240120196000), m.Version)
+		assert.Equal(t, TypeGo, m.Type)
+		assert.Equal(t, "20240120196000_go_migration.go", m.Source)
+	})
+
+	t.Run("run", func(t *testing.T) {
+		migrations, _ := testMigrator.findAvailableMigrations()
+
+		assert.NoError(t, migrations[1].run(ctx, testMigrator.driver, true, &database.ListInfo{Version: 20240120196000}))
+		assert.True(t, called)
+
+		// no down function
+		assert.NoError(t, migrations[1].run(ctx, testMigrator.driver, false, nil))
+	})
+
+	t.Run("duplicate", func(t *testing.T) {
+		assert.Panics(t, func() {
+			AddNamedMigration("20240120196000_another.go", up, nil)
+		})
+
+		assert.Panics(t, func() {
+			AddNamedMigration("wrong_name.go", up, nil)
+		})
+	})
+
+	t.Run("duplicate sql", func(t *testing.T) {
+		AddNamedMigration("20240120195817_go_migration.go", up, nil)
+		defer delete(registeredMigrations, 20240120195817)
+
+		_, err := testMigrator.findAvailableMigrations()
+		assert.ErrorIs(t, err, ErrDuplicateVersion)
+	})
+}
+
+// driver with predefined list of applied versions.
+type appliedDriver struct {
+	stub.Stub
+	applied   []int64
+	checksums map[int64]string
+	saved     []database.ListInfo
+	runErr    error
+
+	// number of migrations passed to each Run
+	batches []int
+
+	// how many times Lock returns ErrLocked
+	lockedTimes int
+
+	// session holding the lock
+	holder *database.LockInfo
+}
+
+func (d *appliedDriver) LockHolder(_ context.Context) (*database.LockInfo, error) {
+	return d.holder, nil
+}
+
+func (d *appliedDriver) Lock(ctx context.Context) error {
+	if d.lockedTimes > 0 {
+		d.lockedTimes--
+		return database.ErrLocked
+	}
+
+	return d.Stub.Lock(ctx)
+}
+
+func (d *appliedDriver) Run(_ context.Context, migrations ...*database.Migration) error {
+	d.batches = append(d.batches, len(migrations))
+
+	if d.runErr != nil {
+		return d.runErr
+	}
+
+	for _, migration := range migrations {
+		if migration.Record != nil {
+			migration.Record.Finish()
+			d.saved = append(d.saved, *migration.Record)
+		}
+	}
+
+	return nil
+}
+
+func (d *appliedDriver) SetVersion(_ context.Context, info *database.ListInfo) error {
+	d.saved = append(d.saved, *info)
+	return nil
+}
+
+func (d *appliedDriver) List(_ context.Context) ([]*database.ListInfo, error) {
+	list := make([]*database.ListInfo, 0, len(d.applied))
+	for _, v := range d.applied {
+		list = append(list, &database.ListInfo{Version: v, State: database.StateApplied, Checksum: d.checksums[v]})
+	}
+
+	return list, nil
+}
+
+func newTestMigrator(applied ...int64) *Migrate {
+	return &Migrate{
+		driver:    &appliedDriver{applied: applied},
+		tablename: DefaultTableName,
+		fsys:      os.DirFS("../../test/migrations"),
+	}
+}
+
+func versions(migrations Migrations) []int64 {
+	result := make([]int64, 0, len(migrations))
+	for _, migr := range migrations {
+		result = append(result, migr.Version)
+	}
+
+	return result
+}
+
+func TestMigrationsForRun(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		first  = int64(20240120195817)
+		second = int64(20240120196753)
+		third  = int64(20240121133022)
+	)
+
+	tests := []struct {
+		name     string
+		applied  []int64
+		up       bool
+		target   int64
+		limit    int
+		expected []int64
+		err      error
+	}{
+		{"up all", nil, true, -1, 0, []int64{first, second, third}, nil},
+		{"up pending", []int64{first}, true, -1, 0, []int64{second, third}, nil},
+		{"up to", nil, true, second, 0, []int64{first, second}, nil},
+		{"up to applied", []int64{first, second}, true, second, 0, nil, ErrAlreadyUpToDate},
+		{"up nothing", []int64{first, second, third}, true, -1, 0, nil, ErrAlreadyUpToDate},
+		{"down one", []int64{first, second}, false, -1, 1, []int64{second}, nil},
+		{"down to", []int64{first, second, third}, false, first, 0, []int64{third, second}, nil},
+		{"down to zero", []int64{first, second, third}, false, 0, 0, []int64{third, second, first}, nil},
+		{"down nothing", nil, false, -1, 1, nil, ErrAlreadyUpToDate},
+		{"up missing", []int64{first, third}, true, -1, 0, nil, ErrMissingMigrations},
+		{"up to before missing", []int64{first, third}, true, first, 0, nil, ErrAlreadyUpToDate},
+		{"up steps", nil, true, -1, 2, []int64{first, second}, nil},
+		{"up too many steps", []int64{first}, true, -1, 3, nil, ErrNotEnoughMigrations},
+		{"down steps", []int64{first, second, third}, false, -1, 2, []int64{third, second}, nil},
+		{"down too many steps", []int64{first}, false, -1, 2, nil, ErrNotEnoughMigrations},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := newTestMigrator(tt.applied...).migrationsForRun(ctx, tt.up, tt.target, tt.limit)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, versions(migrations))
+		})
+	}
+}
+
+func TestMigrationsForGoto(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		first  = int64(20240120195817)
+		second = int64(20240120196753)
+		third  = int64(20240121133022)
+	)
+
+	// the third is rolled back, so the second isn't missing anymore
+	down, up, err := newTestMigrator(first, third).migrationsForGoto(ctx, second)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{third}, versions(down))
+	assert.Equal(t, []int64{second}, versions(up))
+
+	// ...but it's still missing when migrating up to the third
+	_, _, err = newTestMigrator(first, third).migrationsForGoto(ctx, third)
+	assert.ErrorIs(t, err, ErrMissingMigrations)
+
+	_, _, err = newTestMigrator(first, second).migrationsForGoto(ctx, second)
+	assert.ErrorIs(t, err, ErrAlreadyUpToDate)
+}
+
+func TestCheckVersion(t *testing.T) {
+	assert.NoError(t, testMigrator.checkVersion(0))
+	assert.NoError(t, testMigrator.checkVersion(20240120196753))
+	assert.ErrorIs(t, testMigrator.checkVersion(-1), ErrVersionNotFound)
+	assert.ErrorIs(t, testMigrator.checkVersion(1234), ErrVersionNotFound)
+}
+
+func TestSteps(t *testing.T) {
+	_, err := testMigrator.Steps(0)
+	assert.ErrorIs(t, err, ErrZeroSteps)
+}
+
+func TestPlan(t *testing.T) {
+	var buf bytes.Buffer
+
+	migrator := newTestMigrator(20240120195817)
+	migrator.Log = logger.New("INFO", &buf)
+
+	t.Run("plan", func(t *testing.T) {
+		migrations, err := migrator.Plan(DirectionUp, 20240120196753)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{20240120196753}, versions(migrations))
+
+		migrations, err = migrator.Plan(DirectionDown, -1)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{20240120195817}, versions(migrations))
+
+		_, err = migrator.Plan(DirectionUp, 1234)
+		assert.ErrorIs(t, err, ErrVersionNotFound)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		migrator.DryRun = true
+		defer func() { migrator.DryRun = false }()
+
+		buf.Reset()
+		result, err := migrator.Up()
+		assert.NoError(t, err)
+		assert.Empty(t, result.Migrations)
+		assert.Contains(t, buf.String(), "Migration 20240120196753 (20240120196753_test_migration_next.sql) would be applied")
+		assert.Contains(t, buf.String(), "ADD COLUMN column_int int")
+		assert.Contains(t, buf.String(), "Migration 20240121133022")
+
+		buf.Reset()
+		_, err = migrator.Goto(0)
+		assert.NoError(t, err)
+		assert.Contains(t, buf.String(), "Migration 20240120195817 (20240120195817_test_migration_go.sql) would be rolled back")
+		assert.Contains(t, buf.String(), "DROP TABLE test;")
+	})
+}
+
+func TestAllowMissing(t *testing.T) {
+	ctx := context.Background()
+
+	migrator := newTestMigrator(20240120195817, 20240121133022)
+
+	_, err := migrator.migrationsForRun(ctx, true, -1, 0)
+	assert.ErrorIs(t, err, ErrMissingMigrations)
+	assert.ErrorContains(t, err, "20240120196753 (20240120196753_test_migration_next.sql)")
+
+	migrator.AllowMissing = true
+	migrations, err := migrator.migrationsForRun(ctx, true, -1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{20240120196753}, versions(migrations))
+}
+
+func TestApplyMigrationState(t *testing.T) {
+	ctx := context.Background()
+
+	migration := &Migration{Version: 1, Type: TypeSQL, Source: "1_test.sql", UpSQL: "SELECT 1;"}
+
+	t.Run("applied", func(t *testing.T) {
+		migrator := newTestMigrator()
+		driver := migrator.driver.(*appliedDriver)
+
+		assert.NoError(t, migrator.applyMigration(ctx, migration))
+		assert.Len(t, driver.saved, 2)
+
+		assert.Equal(t, database.StateApplying, driver.saved[0].State)
+		assert.Equal(t, "1_test.sql", driver.saved[0].Name)
+		assert.False(t, driver.saved[0].StartedAt.IsZero())
+		assert.True(t, driver.saved[0].AppliedAt.IsZero())
+
+		assert.Equal(t, database.StateApplied, driver.saved[1].State)
+		assert.False(t, driver.saved[1].FinishedAt.IsZero())
+		assert.Equal(t, driver.saved[1].FinishedAt, driver.saved[1].AppliedAt)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		migrator := newTestMigrator()
+		driver := migrator.driver.(*appliedDriver)
+		driver.runErr = errors.New("syntax error")
+
+		assert.ErrorContains(t, migrator.applyMigration(ctx, migration), "syntax error")
+		assert.Len(t, driver.saved, 2)
+
+		assert.Equal(t, database.StateError, driver.saved[1].State)
+		assert.Equal(t, "syntax error", driver.saved[1].LastError)
+		assert.True(t, driver.saved[1].AppliedAt.IsZero())
+	})
+
+	t.Run("rollback error", func(t *testing.T) {
+		migrator := newTestMigrator(1)
+		driver := migrator.driver.(*appliedDriver)
+		driver.runErr = errors.New("syntax error")
+
+		assert.ErrorContains(t, migrator.rollbackMigration(ctx, migration), "syntax error")
+		assert.Len(t, driver.saved, 1)
+
+		// still applied
+		assert.Equal(t, database.StateApplied, driver.saved[0].State)
+		assert.Equal(t, "syntax error", driver.saved[0].LastError)
+	})
+}
+
+func TestResult(t *testing.T) {
+	ctx := context.Background()
+
+	migrations := Migrations{
+		{Version: 1, Type: TypeSQL, Source: "1_first.sql", upStatements: []database.Statement{{SQL: "SELECT 1;", Line: 2}}},
+		{Version: 2, Type: TypeGo, Source: "2_second.go"},
+		{Version: 3, Type: TypeSQL, Source: "3_third.sql", upStatements: []database.Statement{{SQL: "SELECT 3;", Line: 2}}},
+	}
+
+	t.Run("success", func(t *testing.T) {
+		migrator := newTestMigrator()
+		result := &Result{}
+
+		assert.NoError(t, migrator.runSteps(ctx, result, newSteps(migrations, true)))
+		assert.Len(t, result.Migrations, 3)
+		assert.Nil(t, result.Failed())
+
+		first := result.Migrations[0]
+		assert.Equal(t, int64(1), first.Version)
+		assert.Equal(t, "1_first.sql", first.Source)
+		assert.Equal(t, DirectionUp, first.Direction)
+		assert.Equal(t, 1, first.Statements)
+		assert.False(t, first.StartedAt.IsZero())
+		assert.True(t, first.Succeeded())
+
+		assert.Equal(t, 0, result.Migrations[1].Statements)
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		migrator := newTestMigrator()
+		driver := migrator.driver.(*appliedDriver)
+		driver.runErr = errors.New("syntax error")
+		result := &Result{}
+
+		assert.Error(t, migrator.runSteps(ctx, result, newSteps(migrations, false)))
+		assert.Len(t, result.Migrations, 1)
+
+		failed := result.Failed()
+		assert.NotNil(t, failed)
+		assert.Equal(t, int64(1), failed.Version)
+		assert.Equal(t, DirectionDown, failed.Direction)
+		assert.ErrorContains(t, failed.Err, "syntax error")
+	})
+}
+
+func TestAtomic(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		migrator := newTestMigrator()
+		migrator.Atomic = true
+		driver := migrator.driver.(*appliedDriver)
+
+		result, err := migrator.Up()
+		assert.NoError(t, err)
+		assert.Len(t, result.Migrations, 3)
+		assert.Nil(t, result.Failed())
+
+		// single call of Run without "applying" states
+		assert.Equal(t, []int{3}, driver.batches)
+		assert.Len(t, driver.saved, 3)
+		for _, info := range driver.saved {
+			assert.Equal(t, database.StateApplied, info.State)
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		migrator := newTestMigrator(20240120195817, 20240120196753)
+		migrator.Atomic = true
+		driver := migrator.driver.(*appliedDriver)
+		driver.runErr = errors.New("syntax error")
+
+		result, err := migrator.DownTo(0)
+		assert.ErrorContains(t, err, "syntax error")
+		assert.Equal(t, []int{2}, driver.batches)
+		assert.Empty(t, driver.saved)
+
+		// the whole batch is failed
+		assert.Len(t, result.Migrations, 2)
+		for _, res := range result.Migrations {
+			assert.False(t, res.Succeeded())
+			assert.Equal(t, DirectionDown, res.Direction)
+		}
+	})
+
+	t.Run("no transaction", func(t *testing.T) {
+		migrator := newTestMigrator()
+		migrator.Atomic = true
+		migrations := Migrations{
+			{Version: 1, Type: TypeSQL, Source: "1_first.sql"},
+			{Version: 2, Type: TypeSQL, Source: "2_second.sql", NoTransaction: true},
+		}
+
+		err := migrator.runSteps(context.Background(), &Result{}, newSteps(migrations, true))
+		assert.ErrorIs(t, err, ErrAtomicNoTransaction)
+		assert.Empty(t, migrator.driver.(*appliedDriver).batches)
+	})
+}
+
+// hook which records names of called callbacks.
+type recordingHook struct {
+	NopHook
+	events []string
+	result *Result
+	err    error
+}
+
+func (h *recordingHook) BeforeAll(_ context.Context) {
+	h.events = append(h.events, "before all")
+}
+
+func (h *recordingHook) BeforeMigration(_ context.Context, migr *Migration, direction Direction) {
+	h.events = append(h.events, fmt.Sprintf("before %s %d", direction, migr.Version))
+}
+
+func (h *recordingHook) AfterMigration(_ context.Context, migr *Migration, res *MigrationResult) {
+	h.events = append(h.events, fmt.Sprintf("after %s %d", res.Direction, migr.Version))
+}
+
+func (h *recordingHook) OnError(_ context.Context, migr *Migration, res *MigrationResult) {
+	h.events = append(h.events, fmt.Sprintf("error %s %d", res.Direction, migr.Version))
+}
+
+func (h *recordingHook) AfterAll(_ context.Context, result *Result, err error) {
+	h.events = append(h.events, "after all")
+	h.result = result
+	h.err = err
+}
+
+func TestHooks(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		hook := &recordingHook{}
+		migrator := newTestMigrator(20240120195817)
+		migrator.Hooks = []Hook{hook}
+
+		result, err := migrator.Up()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"before all",
+			"before up 20240120196753",
+			"after up 20240120196753",
+			"before up 20240121133022",
+			"after up 20240121133022",
+			"after all",
+		}, hook.events)
+		assert.Same(t, result, hook.result)
+		assert.NoError(t, hook.err)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		hook := &recordingHook{}
+		migrator := newTestMigrator()
+		migrator.driver.(*appliedDriver).runErr = errors.New("syntax error")
+		migrator.Hooks = []Hook{hook}
+
+		_, err := migrator.Up()
+		assert.Error(t, err)
+		assert.Equal(t, []string{
+			"before all",
+			"before up 20240120195817",
+			"error up 20240120195817",
+			"after all",
+		}, hook.events)
+		assert.ErrorContains(t, hook.err, "syntax error")
+	})
+
+	t.Run("atomic", func(t *testing.T) {
+		hook := &recordingHook{}
+		migrator := newTestMigrator(20240120195817)
+		migrator.Atomic = true
+		migrator.Hooks = []Hook{hook}
+
+		// all migrations are run by the single batch
+		_, err := migrator.Up()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"before all",
+			"before up 20240120196753",
+			"before up 20240121133022",
+			"after up 20240120196753",
+			"after up 20240121133022",
+			"after all",
+		}, hook.events)
+	})
+
+	t.Run("atomic error", func(t *testing.T) {
+		hook := &recordingHook{}
+		migrator := newTestMigrator(20240120195817)
+		migrator.Atomic = true
+		migrator.driver.(*appliedDriver).runErr = errors.New("syntax error")
+		migrator.Hooks = []Hook{hook}
+
+		_, err := migrator.Up()
+		assert.Error(t, err)
+		assert.Equal(t, []string{
+			"before all",
+			"before up 20240120196753",
+			"before up 20240121133022",
+			"error up 20240120196753",
+			"error up 20240121133022",
+			"after all",
+		}, hook.events)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		hook := &recordingHook{}
+		migrator := newTestMigrator()
+		migrator.DryRun = true
+		migrator.Hooks = []Hook{hook}
+
+		_, err := migrator.Up()
+		assert.NoError(t, err)
+		assert.Empty(t, hook.events)
+	})
+}
+
+func TestFullList(t *testing.T) {
+	migrator := newTestMigrator(1, 20240120195817, 20240121133022)
+
+	list, err := migrator.FullList()
+	assert.NoError(t, err)
+	assert.Len(t, list, 4)
+
+	expected := []struct {
+		version int64
+		state   State
+	}{
+		{1, StateOrphaned},
+		{20240120195817, StateApplied},
+		{20240120196753, StateOutOfOrder},
+		{20240121133022, StateApplied},
+	}
+
+	for i, e := range expected {
+		assert.Equal(t, e.version, list[i].Version)
+		assert.Equal(t, e.state, list[i].State)
+	}
+
+	// nothing applied
+	list, err = newTestMigrator().FullList()
+	assert.NoError(t, err)
+	assert.Len(t, list, 3)
+
+	for _, migr := range list {
+		assert.Equal(t, StatePending, migr.State)
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	ctx := context.Background()
+
+	migrations, err := testMigrator.findAvailableMigrations()
+	assert.NoError(t, err)
+
+	first := migrations[0]
+	assert.Len(t, first.Checksum, 64)
+	assert.Equal(t, checksum(first.UpSQL, first.DownSQL), first.Checksum)
+	assert.NotEqual(t, checksum(first.UpSQL+" ", first.DownSQL), first.Checksum)
+
+	migrator := newTestMigrator(20240120195817, 20240120196753)
+	driver := migrator.driver.(*appliedDriver)
+	driver.checksums = map[int64]string{
+		20240120195817: first.Checksum,
+		20240120196753: "changed",
+	}
+
+	changed, err := migrator.Verify()
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{20240120196753}, versions(changed))
+
+	_, err = migrator.migrationsForRun(ctx, true, -1, 0)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.ErrorContains(t, err, "20240120196753_test_migration_next.sql")
+
+	// down is allowed
+	_, err = migrator.migrationsForRun(ctx, false, -1, 1)
+	assert.NoError(t, err)
+
+	migrator.IgnoreChecksums = true
+	migrations, err = migrator.migrationsForRun(ctx, true, -1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{20240121133022}, versions(migrations))
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrator := newTestMigrator()
+	migrator.fsys = fstest.MapFS{
+		"1_first.sql":        {Data: []byte("-- +gomigrator Up\nSELECT 1;\n-- +gomigrator Down\nSELECT 2;\n")},
+		"2_second.sql":       {Data: []byte("-- +gomigrator NO TRANSACTION\n-- +gomigrator Up\nSELECT 3;\n-- +gomigrator Down\nSELECT 4;\n")},
+		"README.md":          {Data: []byte("not a migration")},
+		"nested/3_third.sql": {Data: []byte("-- +gomigrator Up\nSELECT 5;\n")},
+		"4_copy.sql":         {Data: []byte("-- +gomigrator Up\nCOPY test FROM stdin;\n1\ta\n\\.\n")},
+	}
+
+	migrations, err := migrator.findAvailableMigrations()
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 4}, versions(migrations))
+	assert.Equal(t, "1_first.sql", migrations[0].Source)
+	assert.Contains(t, migrations[1].UpSQL, "SELECT 3;")
+	assert.Equal(t, []database.Statement{{SQL: "SELECT 3;", Line: 3}}, migrations[1].upStatements)
+	assert.False(t, migrations[0].NoTransaction)
+	assert.True(t, migrations[1].NoTransaction)
+	assert.Equal(t, []database.Statement{{SQL: "COPY test FROM stdin;", Line: 2, CopyData: []byte("1\ta\n")}}, migrations[2].upStatements)
+}
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+
+	fsys := fstest.MapFS{
+		"1_first.sql": {Data: []byte("-- +gomigrator Up\nSELECT 1;\n-- +gomigrator Down\nSELECT 2;\n")},
+	}
+
+	migrator, err := New(
+		WithDB(&sql.DB{}, "stub"),
+		WithFS(fsys),
+		WithSchema("app"),
+		WithTableName("schema_migrations"),
+		WithLogger(logger.New("INFO", &buf)),
+		WithDryRun(true),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "app.schema_migrations", migrator.tablename)
+	assert.True(t, migrator.DryRun)
+
+	_, err = migrator.Up()
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "Migration 1 (1_first.sql) would be applied")
+
+	_, err = New(WithFS(fsys))
+	assert.ErrorIs(t, err, ErrNoConnection)
+
+	_, err = New(WithDB(&sql.DB{}, "unknown"))
+	assert.ErrorIs(t, err, database.ErrUnknownDriver)
+}
+
+func TestWithEmptyDir(t *testing.T) {
+	// the current working directory, not the filesystem root
+	migrator, err := NewMigrator("stub://", DefaultTableName, "")
+	assert.NoError(t, err)
+
+	_, err = fs.Stat(migrator.fsys, "migrate_test.go")
+	assert.NoError(t, err)
+}
+
+func TestLockTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	migrator := newTestMigrator()
+	driver := migrator.driver.(*appliedDriver)
+
+	// don't wait for real
+	migrator.lockRetryInterval = time.Millisecond
+	migrator.lockMaxRetryInterval = 4 * time.Millisecond
+
+	// fail immediately without timeout
+	driver.lockedTimes = 1
+	assert.ErrorIs(t, migrator.lock(ctx), database.ErrLocked)
+
+	// wait for the lock
+	migrator.lockTimeout = time.Second
+	driver.lockedTimes = 2
+	assert.NoError(t, migrator.lock(ctx))
+
+	// timeout
+	migrator.lockTimeout = 20 * time.Millisecond
+	driver.lockedTimes = 100
+	assert.ErrorIs(t, migrator.lock(ctx), database.ErrLocked)
+
+	// report the lock holder
+	migrator.lockTimeout = 0
+	driver.holder = &database.LockInfo{PID: 42, Application: "gomigrator", ClientAddr: "10.0.0.1"}
+	err := migrator.lock(ctx)
+	assert.ErrorIs(t, err, database.ErrLocked)
+	assert.ErrorContains(t, err, `held by pid 42 (application "gomigrator", client 10.0.0.1)`)
+
+	// canceled while waiting
+	migrator.lockTimeout = time.Minute
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, migrator.lock(canceled), context.Canceled)
+}
+
+func TestSQLite(t *testing.T) {
+	fsys := fstest.MapFS{
+		"1_create.sql": {Data: []byte("-- +gomigrator Up\nCREATE TABLE test (id integer, test text);\n-- +gomigrator Down\nDROP TABLE test;\n")},
+		"2_insert.sql": {Data: []byte("-- +gomigrator Up\nINSERT INTO test VALUES (1, 'a');\nINSERT INTO test VALUES (2, 'b');\n-- +gomigrator Down\nDELETE FROM test;\n")},
+	}
+
+	migrator, err := New(
+		WithDSN("sqlite://"+filepath.Join(t.TempDir(), "app.db")),
+		WithFS(fsys),
+		WithLogger(logger.New("ERROR", io.Discard)),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer migrator.Close()
+
+	result, err := migrator.Up()
+	assert.NoError(t, err)
+	assert.Len(t, result.Migrations, 2)
+
+	version, err := migrator.Dbversion()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+
+	_, err = migrator.Up()
+	assert.ErrorIs(t, err, ErrAlreadyUpToDate)
+
+	_, err = migrator.Redo()
+	assert.NoError(t, err)
+
+	_, err = migrator.DownTo(0)
+	assert.NoError(t, err)
+
+	_, err = migrator.Dbversion()
+	assert.ErrorIs(t, err, ErrNoCurrentVersion)
+}
+
+func TestDryRunWithoutTable(t *testing.T) {
+	var buf bytes.Buffer
+
+	fsys := fstest.MapFS{
+		"1_first.sql": {Data: []byte("-- +gomigrator Up\nSELECT 1;\n-- +gomigrator Down\nSELECT -1;\n")},
+	}
+
+	driver := memory.New()
+	migrator, err := New(WithDriver(driver), WithFS(fsys), WithDryRun(true), WithLogger(logger.New("INFO", &buf)))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// missing table is empty history
+	_, err = migrator.Up()
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "Migration 1 (1_first.sql) would be applied")
+
+	// the table isn't created
+	_, err = driver.Version(context.Background())
+	assert.ErrorIs(t, err, memory.ErrNoTable)
+	assert.Empty(t, driver.Executed())
+}
+
+// driver which cancels the run while migration is executed, like SIGTERM or timeout.
+type cancelingDriver struct {
+	*memory.Memory
+	cancel context.CancelFunc
+}
+
+func (d *cancelingDriver) Run(ctx context.Context, _ ...*database.Migration) error {
+	d.cancel()
+	return ctx.Err()
+}
+
+func (d *cancelingDriver) SetVersion(ctx context.Context, info *database.ListInfo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return d.Memory.SetVersion(ctx, info)
+}
+
+func (d *cancelingDriver) List(ctx context.Context) ([]*database.ListInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return d.Memory.List(ctx)
+}
+
+func TestCanceledRun(t *testing.T) {
+	fsys := fstest.MapFS{
+		"1_first.sql": {Data: []byte("-- +gomigrator Up\nSELECT 1;\n-- +gomigrator Down\nSELECT -1;\n")},
+	}
+
+	driver := &cancelingDriver{Memory: memory.New()}
+	migrator, err := New(WithDriver(driver), WithFS(fsys))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// failed migration isn't left "applying"
+	ctx, cancel := context.WithCancel(context.Background())
+	driver.cancel = cancel
+
+	_, err = migrator.UpContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotContains(t, err.Error(), "Additional err")
+
+	list, err := driver.Memory.List(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, database.StateError, list[0].State)
+		assert.Equal(t, "context canceled", list[0].LastError)
+	}
+
+	// the reason of failed rollback is saved as well
+	assert.NoError(t, driver.Memory.SetVersion(context.Background(), &database.ListInfo{
+		Version: 1,
+		State:   database.StateApplied,
+	}))
+
+	ctx, cancel = context.WithCancel(context.Background())
+	driver.cancel = cancel
+
+	_, err = migrator.DownContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotContains(t, err.Error(), "Additional err")
+
+	list, err = driver.Memory.List(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, database.StateApplied, list[0].State)
+		assert.Equal(t, "context canceled", list[0].LastError)
+	}
+}
+
+func TestMemoryDriver(t *testing.T) {
+	fsys := fstest.MapFS{
+		"1_first.sql":  {Data: []byte("-- +gomigrator Up\nSELECT 1;\n-- +gomigrator Down\nSELECT -1;\n")},
+		"2_second.sql": {Data: []byte("-- +gomigrator Up\nSELECT 2;\n-- +gomigrator Down\nSELECT -2;\n")},
+		"3_third.sql":  {Data: []byte("-- +gomigrator Up\nSELECT 3;\n-- +gomigrator Down\nSELECT -3;\n")},
+	}
+
+	driver := memory.New()
+	migrator, err := New(WithDriver(driver), WithFS(fsys), WithLogger(logger.New("ERROR", io.Discard)))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = migrator.UpTo(2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"SELECT 1;", "SELECT 2;"}, driver.Executed())
+	assert.False(t, driver.IsLocked())
+
+	_, err = migrator.Down()
+	assert.NoError(t, err)
+
+	_, err = migrator.Redo()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"SELECT 1;", "SELECT 2;", "SELECT -2;", "SELECT -1;", "SELECT 1;"}, driver.Executed())
+
+	version, err := migrator.Dbversion()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+
+	// failed migration is saved with error
+	driver.FailOn("SELECT 3", errors.New("boom"))
+
+	_, err = migrator.Up()
+	assert.ErrorContains(t, err, "boom")
+	assert.False(t, driver.IsLocked())
+
+	list, err := migrator.FullList()
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, versions(list))
+	assert.Equal(t, StateApplied, list[1].State)
+	assert.Equal(t, StateError, list[2].State)
+	assert.Contains(t, list[2].LastError, "boom")
+	assert.False(t, list[1].AppliedAt.IsZero())
+
+	// the lock is held by another process
+	assert.NoError(t, driver.Lock(context.Background()))
+	_, err = migrator.Up()
+	assert.ErrorIs(t, err, database.ErrLocked)
+}
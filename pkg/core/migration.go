@@ -1,8 +1,34 @@
 package core
 
 import (
-	"database/sql"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"time"
+
+	"github.com/XanderKon/sql-migrator-otus/internal/database"
+)
+
+const (
+	TypeSQL = "sql"
+	TypeGo  = "go"
+)
+
+// State of migration.
+type State string
+
+const (
+	StateApplying State = State(database.StateApplying)
+	StateApplied  State = State(database.StateApplied)
+	StateError    State = State(database.StateError)
+
+	// Migration is not applied yet.
+	StatePending State = "pending"
+	// Migration is not applied yet, but its version is lower than the current one
+	// (it will be applied only in AllowMissing mode).
+	StateOutOfOrder State = "out of order"
+	// Migration is saved in DB, but its file is missing.
+	StateOrphaned State = "orphaned"
 )
 
 type Migration struct {
@@ -15,9 +41,24 @@ type Migration struct {
 	// Path to file
 	Source string
 
-	// Path to file
+	// State of migration saved in DB
+	State State
+
+	// Time when migration was applied
 	AppliedAt time.Time
 
+	// Time of the last run
+	StartedAt time.Time
+
+	// Time when the last run was finished
+	FinishedAt time.Time
+
+	// Duration of the last run
+	Duration time.Duration
+
+	// Error of the last run
+	LastError string
+
 	// Link to next Migration
 	Next *Migration
 
@@ -29,25 +70,97 @@ type Migration struct {
 
 	// Statements to run down (used by SQL-migrations)
 	DownSQL string
+
+	// Function to run up (used by Go-migrations)
+	UpFn GoMigrationFunc
+
+	// Function to run down (used by Go-migrations)
+	DownFn GoMigrationFunc
+
+	// SHA-256 of statements (empty for Go-migrations)
+	Checksum string
+
+	// Run SQL-migration outside of transaction ("-- +gomigrator NO TRANSACTION")
+	NoTransaction bool
+
+	// UpSQL and DownSQL split to statements
+	upStatements   []database.Statement
+	downStatements []database.Statement
 }
 
-func New() *Migration {
-	return &Migration{}
+// UpdatedAt returns time of the last state change.
+func (m *Migration) UpdatedAt() time.Time {
+	updatedAt := m.AppliedAt
+	for _, t := range []time.Time{m.StartedAt, m.FinishedAt} {
+		if t.After(updatedAt) {
+			updatedAt = t
+		}
+	}
+
+	return updatedAt
 }
 
-// Up runs an up migration.
-func (m *Migration) Up(_ *sql.DB) error {
-	// ctx := context.Background()
-	return nil
+// set state of migration from migrations table.
+func (m *Migration) setInfo(info *database.ListInfo) {
+	m.State = State(info.State)
+	m.AppliedAt = info.AppliedAt
+	m.StartedAt = info.StartedAt
+	m.FinishedAt = info.FinishedAt
+	m.Duration = info.Duration
+	m.LastError = info.LastError
 }
 
-// Down runs a down migration.
-func (m *Migration) Down(_ *sql.DB) error {
-	// ctx := context.Background()
-	return nil
+// calc checksum of parsed statements.
+func checksum(upSQL string, downSQL string) string {
+	h := sha256.New()
+	h.Write([]byte(upSQL))
+	h.Write([]byte{0})
+	h.Write([]byte(downSQL))
+
+	return hex.EncodeToString(h.Sum(nil))
 }
 
 // Internal logic of migration here.
-// func (m *Migration) run(_ context.Context, _ *sql.DB, _ bool) error {
-// 	return nil
-// }
+// up -- direction, record -- row to save after run (nil to delete version).
+func (m *Migration) run(ctx context.Context, driver database.Driver, up bool, record *database.ListInfo) error {
+	return driver.Run(ctx, m.driverMigration(up, record))
+}
+
+// prepare migration for database.Driver.
+func (m *Migration) driverMigration(up bool, record *database.ListInfo) *database.Migration {
+	migration := &database.Migration{
+		Version: m.Version,
+		Record:  record,
+	}
+
+	if m.Type == TypeGo {
+		fn := m.DownFn
+		if up {
+			fn = m.UpFn
+		}
+
+		// nil function -- just update version
+		if fn != nil {
+			migration.Func = database.TxFunc(fn)
+		}
+	} else {
+		migration.Statements = m.statements(up)
+		migration.NoTransaction = m.NoTransaction
+	}
+
+	return migration
+}
+
+// get SQL statements for passed direction.
+func (m *Migration) statements(up bool) []database.Statement {
+	if up {
+		return m.upStatements
+	}
+
+	return m.downStatements
+}
+
+// number of SQL statements sent to the DB.
+func (m *Migration) statementsCount(up bool) int {
+	return len(m.statements(up))
+}
@@ -0,0 +1,168 @@
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/XanderKon/sql-migrator-otus/internal/database"
+)
+
+var ErrNoConnection = errors.New("no DSN, DB connection or driver was set")
+
+// DefaultDir is a folder with migrations used when neither WithDir nor WithFS is set.
+const DefaultDir = "./migrations"
+
+// Logger is used by migrator to report progress.
+type Logger interface {
+	Info(msg string, params ...any)
+	Warning(msg string, params ...any)
+}
+
+// Option configures migrator created by New.
+type Option func(o *options)
+
+type options struct {
+	dsn             string
+	db              *sql.DB
+	driver          database.Driver
+	driverName      string
+	tableName       string
+	schema          string
+	fsys            fs.FS
+	log             Logger
+	lockTimeout     time.Duration
+	lockID          int64
+	searchPath      bool
+	dryRun          bool
+	allowMissing    bool
+	ignoreChecksums bool
+	atomic          bool
+	hooks           []Hook
+}
+
+// WithDSN sets connection string, new connection will be opened by migrator.
+func WithDSN(dsn string) Option {
+	return func(o *options) {
+		o.dsn = dsn
+	}
+}
+
+// WithDB sets already opened connection pool, driverName is a name of
+// registered driver (e.g. "postgres"). Migrator doesn't close passed db.
+func WithDB(db *sql.DB, driverName string) Option {
+	return func(o *options) {
+		o.db = db
+		o.driverName = driverName
+	}
+}
+
+// WithDriver sets already created driver (e.g. *memory.Memory in tests).
+// Table name, schema and lock options are not applied to it.
+func WithDriver(driver database.Driver) Option {
+	return func(o *options) {
+		o.driver = driver
+	}
+}
+
+// WithTableName sets name of migrations table ("migrations" by default).
+func WithTableName(tableName string) Option {
+	return func(o *options) {
+		o.tableName = tableName
+	}
+}
+
+// WithSchema sets DB schema of migrations table.
+func WithSchema(schema string) Option {
+	return func(o *options) {
+		o.schema = schema
+	}
+}
+
+// WithSearchPath sets search_path to schema (see WithSchema) while running migrations,
+// so unqualified names in migrations refer to this schema.
+func WithSearchPath(searchPath bool) Option {
+	return func(o *options) {
+		o.searchPath = searchPath
+	}
+}
+
+// WithDir sets folder with migrations, empty dir means the current working directory.
+func WithDir(dir string) Option {
+	return func(o *options) {
+		// os.DirFS("") resolves paths from the filesystem root
+		if dir == "" {
+			dir = "."
+		}
+
+		o.fsys = os.DirFS(dir)
+	}
+}
+
+// WithFS sets file system with migrations in its root (e.g. embed.FS).
+func WithFS(fsys fs.FS) Option {
+	return func(o *options) {
+		o.fsys = fsys
+	}
+}
+
+// WithLogger sets logger for progress messages and messages of DB server
+// (e.g. NOTICE of PostgreSQL with pgx:// DSN).
+func WithLogger(log Logger) Option {
+	return func(o *options) {
+		o.log = log
+	}
+}
+
+// WithLockTimeout sets how long migrator waits for the lock held by
+// another process (fails immediately by default).
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.lockTimeout = timeout
+	}
+}
+
+// WithLockID overrides key of migrations lock (by default it's derived
+// from DB name and table name).
+func WithLockID(lockID int64) Option {
+	return func(o *options) {
+		o.lockID = lockID
+	}
+}
+
+// WithDryRun enables DryRun mode.
+func WithDryRun(dryRun bool) Option {
+	return func(o *options) {
+		o.dryRun = dryRun
+	}
+}
+
+// WithAllowMissing enables AllowMissing mode.
+func WithAllowMissing(allowMissing bool) Option {
+	return func(o *options) {
+		o.allowMissing = allowMissing
+	}
+}
+
+// WithIgnoreChecksums enables IgnoreChecksums mode.
+func WithIgnoreChecksums(ignoreChecksums bool) Option {
+	return func(o *options) {
+		o.ignoreChecksums = ignoreChecksums
+	}
+}
+
+// WithAtomic enables Atomic mode.
+func WithAtomic(atomic bool) Option {
+	return func(o *options) {
+		o.atomic = atomic
+	}
+}
+
+// WithHooks adds hooks called around migrations run.
+func WithHooks(hooks ...Hook) Option {
+	return func(o *options) {
+		o.hooks = append(o.hooks, hooks...)
+	}
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// print plan for Goto.
+func (m *Migrate) gotoPlan(ctx context.Context, version int64) error {
+	down, up, err := m.migrationsForGoto(ctx, version)
+	if err != nil {
+		return err
+	}
+
+	m.printPlan(down, false)
+	m.printPlan(up, true)
+
+	return nil
+}
+
+// print plan for Redo.
+func (m *Migrate) redoPlan(ctx context.Context) error {
+	currentMigration, err := m.currentMigration(ctx)
+	if errors.Is(err, ErrNoCurrentVersion) {
+		m.printLog(err.Error())
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	m.printPlan(Migrations{currentMigration}, false)
+	m.printPlan(Migrations{currentMigration}, true)
+
+	return nil
+}
+
+// print version, file and statements of each migration.
+func (m *Migrate) printPlan(migrations Migrations, up bool) {
+	action := "rolled back"
+	if up {
+		action = "applied"
+	}
+
+	for _, migr := range migrations {
+		m.printLog(fmt.Sprintf("[DRY RUN] Migration %d (%s) would be %s:\n%s",
+			migr.Version, migr.Source, action, migr.body(up)))
+	}
+}
+
+// text representation of migration body.
+func (m *Migration) body(up bool) string {
+	if m.Type == TypeGo {
+		return "-- Go-migration, code can't be shown\n"
+	}
+
+	query := m.DownSQL
+	if up {
+		query = m.UpSQL
+	}
+
+	if strings.TrimSpace(query) == "" {
+		return "-- empty migration\n"
+	}
+
+	if m.NoTransaction {
+		return "-- without transaction\n" + query
+	}
+
+	return query
+}
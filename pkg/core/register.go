@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// GoMigrationFunc is a signature of Up/Down functions of Go-migration.
+type GoMigrationFunc func(ctx context.Context, tx *sql.Tx) error
+
+var registeredMu sync.RWMutex
+
+// list of Go-migrations registered by AddMigration (version => migration).
+var registeredMigrations = make(map[int64]*Migration)
+
+// AddMigration registers Go-migration. Version of migration is taken from
+// name of the file where AddMigration is called (e.g. "1706128932160_add_users.go"),
+// so it should be called from init() function of migration file:
+//
+//	func init() {
+//		core.AddMigration(Up_1706128932160_add_users, Down_1706128932160_add_users)
+//	}
+func AddMigration(up GoMigrationFunc, down GoMigrationFunc) {
+	_, filename, _, _ := runtime.Caller(1)
+	AddNamedMigration(filename, up, down)
+}
+
+// AddNamedMigration registers Go-migration with version from passed filename.
+func AddNamedMigration(filename string, up GoMigrationFunc, down GoMigrationFunc) {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+
+	source := filepath.Base(filename)
+
+	version := getVersionFromFileName(source)
+	if version <= 0 {
+		panic(fmt.Sprintf("can't get migration version from file name %s", source))
+	}
+
+	if existing, dup := registeredMigrations[version]; dup {
+		panic(fmt.Sprintf("migration %d is already registered by %s", version, existing.Source))
+	}
+
+	registeredMigrations[version] = &Migration{
+		Version: version,
+		Type:    TypeGo,
+		Source:  source,
+		UpFn:    up,
+		DownFn:  down,
+	}
+}
+
+// get copies of all registered Go-migrations.
+func registeredGoMigrations() Migrations {
+	registeredMu.RLock()
+	defer registeredMu.RUnlock()
+
+	migrations := make(Migrations, 0, len(registeredMigrations))
+	for _, migr := range registeredMigrations {
+		copied := *migr
+		migrations = append(migrations, &copied)
+	}
+
+	return migrations
+}
@@ -0,0 +1,69 @@
+package core
+
+import "time"
+
+// Result of migrations run.
+type Result struct {
+	// Executed migrations in order of execution (the last one may be failed)
+	Migrations []*MigrationResult
+}
+
+// MigrationResult is a result of single migration run.
+type MigrationResult struct {
+	Version   int64
+	Source    string
+	Direction Direction
+
+	// Time when migration was started
+	StartedAt time.Time
+
+	// Duration of migration run including update of migrations table
+	Duration time.Duration
+
+	// Number of SQL statements executed (0 for Go-migrations)
+	Statements int
+
+	// Error of migration run (nil if success)
+	Err error
+}
+
+func newMigrationResult(migr *Migration, up bool) *MigrationResult {
+	direction := DirectionDown
+	if up {
+		direction = DirectionUp
+	}
+
+	return &MigrationResult{
+		Version:    migr.Version,
+		Source:     migr.Source,
+		Direction:  direction,
+		StartedAt:  time.Now(),
+		Statements: migr.statementsCount(up),
+	}
+}
+
+// Succeeded returns true if migration was executed without errors.
+func (r *MigrationResult) Succeeded() bool {
+	return r.Err == nil
+}
+
+// Duration returns total duration of all executed migrations.
+func (r *Result) Duration() time.Duration {
+	var total time.Duration
+	for _, res := range r.Migrations {
+		total += res.Duration
+	}
+
+	return total
+}
+
+// Failed returns failed migration or nil if all of them were executed successfully.
+func (r *Result) Failed() *MigrationResult {
+	for _, res := range r.Migrations {
+		if !res.Succeeded() {
+			return res
+		}
+	}
+
+	return nil
+}
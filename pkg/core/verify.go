@@ -0,0 +1,82 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/XanderKon/sql-migrator-otus/internal/database"
+)
+
+// Verify compares checksums of applied migrations with their files
+// and returns migrations which were changed after applying.
+func (m *Migrate) Verify() (Migrations, error) {
+	return m.VerifyContext(context.Background())
+}
+
+// VerifyContext is like Verify, but can be canceled by ctx.
+func (m *Migrate) VerifyContext(ctx context.Context) (Migrations, error) {
+	if err := m.lock(ctx); err != nil {
+		return make(Migrations, 0), err
+	}
+
+	list, err := m.list(ctx)
+	if err != nil {
+		return make(Migrations, 0), m.unlock(ctx, err)
+	}
+
+	availableMigrations, err := m.findAvailableMigrations()
+	if err != nil {
+		return make(Migrations, 0), m.unlock(ctx, err)
+	}
+
+	return changedMigrations(availableMigrations, list), m.unlock(ctx, nil)
+}
+
+// return error if some applied migrations were changed (or just log it in IgnoreChecksums mode).
+func (m *Migrate) checkChecksums(availableMigrations Migrations, list []*database.ListInfo) error {
+	changed := changedMigrations(availableMigrations, list)
+	if len(changed) == 0 {
+		return nil
+	}
+
+	err := checksumError(changed)
+	if !m.IgnoreChecksums {
+		return err
+	}
+
+	if m.Log != nil {
+		m.Log.Warning(err.Error())
+	}
+
+	return nil
+}
+
+// find applied migrations with checksum different from the saved one.
+// Migrations without saved checksum (Go-migrations or applied by old versions) are skipped.
+func changedMigrations(availableMigrations Migrations, list []*database.ListInfo) Migrations {
+	changed := make(Migrations, 0)
+
+	for _, info := range list {
+		if info.State != database.StateApplied || info.Checksum == "" {
+			continue
+		}
+
+		for _, migr := range availableMigrations {
+			if migr.Version == info.Version && migr.Checksum != "" && migr.Checksum != info.Checksum {
+				changed = append(changed, migr)
+			}
+		}
+	}
+
+	return changed
+}
+
+func checksumError(changed Migrations) error {
+	names := make([]string, 0, len(changed))
+	for _, migr := range changed {
+		names = append(names, fmt.Sprintf("%d (%s)", migr.Version, migr.Source))
+	}
+
+	return fmt.Errorf("%w: %s", ErrChecksumMismatch, strings.Join(names, ", "))
+}
@@ -0,0 +1,319 @@
+// Package drivertest checks that migrations driver respects the contract
+// of database.Driver expected by the migrator:
+//
+//	func TestConformance(t *testing.T) {
+//		drivertest.Run(t, func(t *testing.T) database.Driver {
+//			driver, err := database.Open(dsn, database.Config{TableName: "migrations_" + t.Name()})
+//			...
+//			return driver
+//		})
+//	}
+//
+// open is called for every subtest and must return driver with empty migrations
+// table (e.g. the table with unique name), the suite calls PrepareTable and Close itself.
+// Statements are not executed, so the suite doesn't depend on SQL dialect.
+package drivertest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/XanderKon/sql-migrator-otus/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+// OpenFunc returns new driver for test t.
+type OpenFunc func(t *testing.T) database.Driver
+
+// Run runs all conformance tests as subtests of t.
+func Run(t *testing.T, open OpenFunc) {
+	t.Helper()
+
+	tests := []struct {
+		name string
+		test func(t *testing.T, driver database.Driver)
+	}{
+		{name: "PrepareTable", test: testPrepareTable},
+		{name: "Empty", test: testEmpty},
+		{name: "SetVersion", test: testSetVersion},
+		{name: "DeleteVersion", test: testDeleteVersion},
+		{name: "Lock", test: testLock},
+		{name: "Run", test: testRun},
+		{name: "RunRollback", test: testRunRollback},
+		{name: "RunNoTransaction", test: testRunNoTransaction},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := open(t)
+			t.Cleanup(func() {
+				assert.NoError(t, driver.Close())
+			})
+
+			noError(t, driver.PrepareTable(context.Background()))
+
+			tt.test(t, driver)
+		})
+	}
+}
+
+// stop the test on error (require isn't used outside of tests).
+func noError(t *testing.T, err error) {
+	t.Helper()
+
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+}
+
+func hasLen(t *testing.T, versions []*database.ListInfo, length int) {
+	t.Helper()
+
+	if !assert.Len(t, versions, length) {
+		t.FailNow()
+	}
+}
+
+// stored timestamps may lose precision and time zone.
+func assertTime(t *testing.T, expected, actual time.Time) {
+	t.Helper()
+
+	assert.WithinDuration(t, expected, actual, time.Millisecond)
+}
+
+func assertVersion(t *testing.T, driver database.Driver, expected int64) {
+	t.Helper()
+
+	version, err := driver.Version(context.Background())
+	noError(t, err)
+	assert.Equal(t, expected, version)
+}
+
+func list(t *testing.T, driver database.Driver) []*database.ListInfo {
+	t.Helper()
+
+	list, err := driver.List(context.Background())
+	noError(t, err)
+
+	return list
+}
+
+// PrepareTable may be called for existing table.
+func testPrepareTable(t *testing.T, driver database.Driver) {
+	ctx := context.Background()
+
+	noError(t, driver.SetVersion(ctx, &database.ListInfo{Version: 1, State: database.StateApplied}))
+	noError(t, driver.PrepareTable(ctx))
+
+	assert.Len(t, list(t, driver), 1)
+}
+
+// Version is -1 and List is empty (not nil) slice without migrations.
+func testEmpty(t *testing.T, driver database.Driver) {
+	assertVersion(t, driver, -1)
+
+	versions := list(t, driver)
+	assert.NotNil(t, versions)
+	assert.Empty(t, versions)
+}
+
+func testSetVersion(t *testing.T, driver database.Driver) {
+	ctx := context.Background()
+
+	startedAt := time.Date(2024, 1, 20, 19, 58, 17, 123000000, time.UTC)
+	applied := &database.ListInfo{
+		Version:    2,
+		Name:       "2_second.sql",
+		State:      database.StateApplied,
+		StartedAt:  startedAt,
+		FinishedAt: startedAt.Add(1500 * time.Millisecond),
+		Duration:   1500 * time.Millisecond,
+		AppliedAt:  startedAt.Add(1500 * time.Millisecond),
+		Checksum:   "0123456789abcdef",
+	}
+	failed := &database.ListInfo{
+		Version:   3,
+		Name:      "3_third.sql",
+		State:     database.StateError,
+		StartedAt: startedAt,
+		LastError: "statement at line 1: boom",
+	}
+
+	// in any order
+	noError(t, driver.SetVersion(ctx, failed))
+	noError(t, driver.SetVersion(ctx, applied))
+	noError(t, driver.SetVersion(ctx, &database.ListInfo{Version: 1, State: database.StateApplied}))
+
+	// only applied migration is current
+	assertVersion(t, driver, 2)
+
+	versions := list(t, driver)
+	hasLen(t, versions, 3)
+
+	// sorted by version
+	assert.Equal(t, int64(1), versions[0].Version)
+	assert.Equal(t, int64(2), versions[1].Version)
+	assert.Equal(t, int64(3), versions[2].Version)
+
+	got := versions[1]
+	assert.Equal(t, applied.Name, got.Name)
+	assert.Equal(t, applied.State, got.State)
+	assert.Equal(t, applied.Duration, got.Duration)
+	assert.Equal(t, applied.Checksum, got.Checksum)
+	assertTime(t, applied.StartedAt, got.StartedAt)
+	assertTime(t, applied.FinishedAt, got.FinishedAt)
+	assertTime(t, applied.AppliedAt, got.AppliedAt)
+
+	// zero times are kept
+	got = versions[2]
+	assert.Equal(t, failed.State, got.State)
+	assert.Equal(t, failed.LastError, got.LastError)
+	assert.True(t, got.FinishedAt.IsZero())
+	assert.True(t, got.AppliedAt.IsZero())
+
+	// existing version is updated
+	failed.State = database.StateApplied
+	failed.LastError = ""
+	failed.AppliedAt = startedAt
+	noError(t, driver.SetVersion(ctx, failed))
+
+	assertVersion(t, driver, 3)
+
+	versions = list(t, driver)
+	hasLen(t, versions, 3)
+	assert.Empty(t, versions[2].LastError)
+	assertTime(t, startedAt, versions[2].AppliedAt)
+}
+
+func testDeleteVersion(t *testing.T, driver database.Driver) {
+	ctx := context.Background()
+
+	noError(t, driver.SetVersion(ctx, &database.ListInfo{Version: 1, State: database.StateApplied}))
+	noError(t, driver.SetVersion(ctx, &database.ListInfo{Version: 2, State: database.StateApplied}))
+
+	noError(t, driver.DeleteVersion(ctx, 2))
+	assertVersion(t, driver, 1)
+
+	// missing version isn't an error
+	noError(t, driver.DeleteVersion(ctx, 42))
+
+	noError(t, driver.DeleteVersion(ctx, 1))
+	assertVersion(t, driver, -1)
+	assert.Empty(t, list(t, driver))
+}
+
+// Lock returns ErrLocked when the lock is held, Unlock returns ErrUnlock when it isn't.
+func testLock(t *testing.T, driver database.Driver) {
+	ctx := context.Background()
+
+	assert.ErrorIs(t, driver.Unlock(ctx), database.ErrUnlock)
+
+	noError(t, driver.Lock(ctx))
+	assert.ErrorIs(t, driver.Lock(ctx), database.ErrLocked)
+
+	noError(t, driver.Unlock(ctx))
+	assert.ErrorIs(t, driver.Unlock(ctx), database.ErrUnlock)
+
+	// can be locked again
+	noError(t, driver.Lock(ctx))
+	noError(t, driver.Unlock(ctx))
+}
+
+// Run finishes and saves record, nil record deletes version.
+func testRun(t *testing.T, driver database.Driver) {
+	ctx := context.Background()
+
+	called := 0
+	record := &database.ListInfo{
+		Version:   1,
+		Name:      "1_first.go",
+		State:     database.StateApplied,
+		StartedAt: time.Now().UTC(),
+	}
+
+	err := driver.Run(ctx, &database.Migration{
+		Version: 1,
+		Func: func(_ context.Context, _ *sql.Tx) error {
+			called++
+			return nil
+		},
+		Record: record,
+	})
+	noError(t, err)
+	assert.Equal(t, 1, called)
+
+	// timestamps are set by Finish
+	assert.False(t, record.FinishedAt.IsZero())
+	assert.False(t, record.AppliedAt.IsZero())
+
+	assertVersion(t, driver, 1)
+
+	versions := list(t, driver)
+	hasLen(t, versions, 1)
+	assert.Equal(t, record.Name, versions[0].Name)
+	assertTime(t, record.AppliedAt, versions[0].AppliedAt)
+
+	// rollback of migration
+	err = driver.Run(ctx, &database.Migration{Version: 1})
+	noError(t, err)
+
+	assertVersion(t, driver, -1)
+	assert.Empty(t, list(t, driver))
+}
+
+// nothing is saved if any migration of batch fails.
+func testRunRollback(t *testing.T, driver database.Driver) {
+	ctx := context.Background()
+
+	boom := errors.New("boom")
+
+	err := driver.Run(ctx,
+		&database.Migration{
+			Version: 1,
+			Record:  &database.ListInfo{Version: 1, State: database.StateApplied, StartedAt: time.Now().UTC()},
+		},
+		&database.Migration{
+			Version: 2,
+			Func: func(_ context.Context, _ *sql.Tx) error {
+				return boom
+			},
+			Record: &database.ListInfo{Version: 2, State: database.StateApplied, StartedAt: time.Now().UTC()},
+		},
+	)
+	assert.ErrorIs(t, err, boom)
+
+	assertVersion(t, driver, -1)
+	assert.Empty(t, list(t, driver))
+}
+
+// several migrations without transaction can't be executed together.
+func testRunNoTransaction(t *testing.T, driver database.Driver) {
+	ctx := context.Background()
+
+	err := driver.Run(ctx,
+		&database.Migration{
+			Version:       1,
+			NoTransaction: true,
+			Record:        &database.ListInfo{Version: 1, State: database.StateApplied},
+		},
+		&database.Migration{
+			Version:       2,
+			NoTransaction: true,
+			Record:        &database.ListInfo{Version: 2, State: database.StateApplied},
+		},
+	)
+	assert.ErrorIs(t, err, database.ErrNoTransaction)
+	assert.Empty(t, list(t, driver))
+
+	// the only one is fine
+	err = driver.Run(ctx, &database.Migration{
+		Version:       1,
+		NoTransaction: true,
+		Record:        &database.ListInfo{Version: 1, State: database.StateApplied, StartedAt: time.Now().UTC()},
+	})
+	noError(t, err)
+	assertVersion(t, driver, 1)
+}
@@ -0,0 +1,316 @@
+// Package memory provides migrations driver keeping everything in memory.
+// It's intended for unit tests of migration flows without real database:
+//
+//	driver := memory.New()
+//	migrator, err := core.New(core.WithDriver(driver), core.WithFS(fsys))
+//	...
+//	_, err = migrator.Up()
+//	fmt.Println(driver.Executed())
+//
+// The driver is registered as "memory" as well, DSN "memory://name" opens
+// the instance returned by Instance(name).
+//
+// Statements are not parsed or executed, they are only recorded. Go migrations
+// are called with nil *sql.Tx.
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/XanderKon/sql-migrator-otus/internal/database"
+)
+
+// ErrNoTable is returned like by real database when PrepareTable wasn't called.
+var ErrNoTable = errors.New("migrations table doesn't exist")
+
+// Memory is in-memory migrations driver, it's safe for concurrent use.
+type Memory struct {
+	mu sync.Mutex
+
+	locked   bool
+	prepared bool
+	versions map[int64]database.ListInfo
+	executed []string
+
+	// errors returned by statements containing the key
+	failures map[string]error
+}
+
+var (
+	instancesMu sync.Mutex
+	instances   = make(map[string]*Memory)
+)
+
+// init itself.
+func init() {
+	database.Register("memory", &Memory{})
+}
+
+// New returns empty driver (not available by DSN).
+func New() *Memory {
+	return &Memory{
+		versions: make(map[int64]database.ListInfo),
+		failures: make(map[string]error),
+	}
+}
+
+// Instance returns driver opened by DSN "memory://name", it's created on the first call.
+func Instance(name string) *Memory {
+	instancesMu.Lock()
+	defer instancesMu.Unlock()
+
+	m, ok := instances[name]
+	if !ok {
+		m = New()
+		instances[name] = m
+	}
+
+	return m
+}
+
+// Open returns shared instance, so all migrators with the same DSN use the same state.
+func (m *Memory) Open(url string, _ database.Config) (database.Driver, error) {
+	i := strings.Index(url, "://")
+	if i < 0 {
+		return nil, database.ErrParseDSN
+	}
+
+	return Instance(url[i+3:]), nil
+}
+
+// Close keeps the state, so it can be checked after migrator is closed.
+func (m *Memory) Close() error {
+	return nil
+}
+
+func (m *Memory) Lock(_ context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.locked {
+		return database.ErrLocked
+	}
+
+	m.locked = true
+
+	return nil
+}
+
+func (m *Memory) Unlock(_ context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.locked {
+		return database.ErrUnlock
+	}
+
+	m.locked = false
+
+	return nil
+}
+
+// Run records statements and saves versions. Changes of versions are
+// rolled back on error unless the only migration has NoTransaction set.
+func (m *Memory) Run(ctx context.Context, migrations ...*database.Migration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if len(migrations) == 0 {
+		return nil
+	}
+
+	inTx := len(migrations) > 1 || !migrations[0].NoTransaction || migrations[0].Func != nil
+
+	for _, migration := range migrations {
+		if migration.NoTransaction && len(migrations) > 1 {
+			return fmt.Errorf("migration %d: %w", migration.Version, database.ErrNoTransaction)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.prepared {
+		return ErrNoTable
+	}
+
+	// "transaction"
+	saved := make(map[int64]database.ListInfo, len(m.versions))
+	for version, info := range m.versions {
+		saved[version] = info
+	}
+
+	for _, migration := range migrations {
+		if err := m.run(ctx, migration); err != nil {
+			if len(migrations) > 1 {
+				err = fmt.Errorf("migration %d: %w", migration.Version, err)
+			}
+
+			if inTx {
+				m.versions = saved
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// execute migration and update versions.
+func (m *Memory) run(ctx context.Context, migration *database.Migration) error {
+	if migration.Func != nil {
+		if err := migration.Func(ctx, nil); err != nil {
+			return err
+		}
+	}
+
+	for _, statement := range migration.Statements {
+		if err := m.exec(statement.SQL); err != nil {
+			return database.StatementError(statement, err)
+		}
+	}
+
+	if migration.Record == nil {
+		delete(m.versions, migration.Version)
+		return nil
+	}
+
+	migration.Record.Finish()
+	m.versions[migration.Version] = *migration.Record
+
+	return nil
+}
+
+func (m *Memory) exec(query string) error {
+	m.executed = append(m.executed, query)
+
+	for substr, err := range m.failures {
+		if strings.Contains(query, substr) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Insert or update version of migration.
+func (m *Memory) SetVersion(_ context.Context, info *database.ListInfo) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.prepared {
+		return ErrNoTable
+	}
+
+	m.versions[info.Version] = *info
+
+	return nil
+}
+
+func (m *Memory) DeleteVersion(_ context.Context, version int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.prepared {
+		return ErrNoTable
+	}
+
+	delete(m.versions, version)
+
+	return nil
+}
+
+// Version returns the currently active version.
+// When no migration has been applied, it must return version -1.
+func (m *Memory) Version(_ context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.prepared {
+		return -1, ErrNoTable
+	}
+
+	version := int64(-1)
+	for _, info := range m.versions {
+		if info.State == database.StateApplied && info.Version > version {
+			version = info.Version
+		}
+	}
+
+	return version, nil
+}
+
+// List returns copies of all saved versions of migrations in any state.
+// When no migration has been saved, it must return empty slice.
+func (m *Memory) List(_ context.Context) ([]*database.ListInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.prepared {
+		return []*database.ListInfo{}, ErrNoTable
+	}
+
+	versions := make([]*database.ListInfo, 0, len(m.versions))
+	for _, info := range m.versions {
+		info := info
+		versions = append(versions, &info)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+
+	return versions, nil
+}
+
+// "Create" migrations table.
+func (m *Memory) PrepareTable(_ context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prepared = true
+
+	return nil
+}
+
+// Executed returns all statements passed to Run (including rolled back ones).
+func (m *Memory) Executed() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.executed...)
+}
+
+// IsLocked reports whether the lock is held.
+func (m *Memory) IsLocked() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.locked
+}
+
+// FailOn makes statements containing substr fail with err.
+func (m *Memory) FailOn(substr string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.failures[substr] = err
+}
+
+// Reset returns driver to the initial state (as returned by New).
+func (m *Memory) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.locked = false
+	m.prepared = false
+	m.versions = make(map[int64]database.ListInfo)
+	m.executed = nil
+	m.failures = make(map[string]error)
+}
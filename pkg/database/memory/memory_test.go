@@ -0,0 +1,145 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/XanderKon/sql-migrator-otus/internal/database"
+	"github.com/XanderKon/sql-migrator-otus/pkg/database/drivertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpen(t *testing.T) {
+	driver, err := database.Open("memory://open", database.Config{})
+	require.NoError(t, err)
+	assert.Same(t, Instance("open"), driver)
+	assert.NotSame(t, Instance("other"), driver)
+
+	_, err = database.Open("memory:open", database.Config{})
+	assert.ErrorIs(t, err, database.ErrParseDSN)
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+
+	assert.ErrorIs(t, m.Unlock(ctx), database.ErrUnlock)
+
+	require.NoError(t, m.Lock(ctx))
+	assert.True(t, m.IsLocked())
+	assert.ErrorIs(t, m.Lock(ctx), database.ErrLocked)
+
+	require.NoError(t, m.Unlock(ctx))
+	assert.False(t, m.IsLocked())
+}
+
+func TestVersions(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+
+	_, err := m.Version(ctx)
+	assert.ErrorIs(t, err, ErrNoTable)
+
+	require.NoError(t, m.PrepareTable(ctx))
+
+	version, err := m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), version)
+
+	list, err := m.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	require.NoError(t, m.SetVersion(ctx, &database.ListInfo{Version: 2, State: database.StateError}))
+	require.NoError(t, m.SetVersion(ctx, &database.ListInfo{Version: 1, State: database.StateApplied}))
+
+	version, err = m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+
+	list, err = m.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, int64(1), list[0].Version)
+	assert.Equal(t, int64(2), list[1].Version)
+
+	// copies are returned
+	list[0].State = database.StateError
+	version, err = m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+
+	require.NoError(t, m.DeleteVersion(ctx, 1))
+	version, err = m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), version)
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	require.NoError(t, m.PrepareTable(ctx))
+
+	record := &database.ListInfo{Version: 1, State: database.StateApplied, StartedAt: time.Now()}
+	err := m.Run(ctx, &database.Migration{
+		Version:    1,
+		Statements: []database.Statement{{SQL: "CREATE TABLE test (id int);", Line: 2}},
+		Record:     record,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CREATE TABLE test (id int);"}, m.Executed())
+
+	list, err := m.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.False(t, list[0].AppliedAt.IsZero())
+	assert.Equal(t, record.Duration, list[0].Duration)
+
+	// the whole batch is rolled back
+	boom := errors.New("boom")
+	m.FailOn("missing_table", boom)
+
+	err = m.Run(ctx,
+		&database.Migration{Version: 1, Statements: []database.Statement{{SQL: "DROP TABLE test;", Line: 5}}},
+		&database.Migration{
+			Version:    2,
+			Statements: []database.Statement{{SQL: "SELECT * FROM missing_table;", Line: 3}},
+			Record:     &database.ListInfo{Version: 2, State: database.StateApplied},
+		},
+	)
+	assert.ErrorIs(t, err, boom)
+	assert.ErrorContains(t, err, "migration 2: statement at line 3")
+
+	version, err := m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+
+	// ...but not without transaction
+	err = m.Run(ctx, &database.Migration{
+		Version:       1,
+		Statements:    []database.Statement{{SQL: "DROP TABLE test;"}, {SQL: "SELECT * FROM missing_table;"}},
+		NoTransaction: true,
+	})
+	assert.ErrorIs(t, err, boom)
+	assert.Len(t, m.Executed(), 5)
+
+	noTx := &database.Migration{Version: 2, NoTransaction: true}
+	assert.ErrorIs(t, m.Run(ctx, noTx, noTx), database.ErrNoTransaction)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, m.Run(canceled, noTx), context.Canceled)
+
+	m.Reset()
+	assert.Empty(t, m.Executed())
+	assert.ErrorIs(t, m.Run(ctx, noTx), ErrNoTable)
+}
+
+func TestConformance(t *testing.T) {
+	drivertest.Run(t, func(_ *testing.T) database.Driver {
+		return New()
+	})
+}
@@ -0,0 +1,68 @@
+//go:build integration
+// +build integration
+
+package test
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/XanderKon/sql-migrator-otus/internal/database"
+	"github.com/XanderKon/sql-migrator-otus/pkg/database/drivertest"
+	"github.com/stretchr/testify/require"
+)
+
+// every subtest uses its own migrations table.
+var conformanceTables atomic.Int64
+
+// open returns driver for the new table, the table is dropped after test.
+func openConformance(t *testing.T, dsn string, db *sql.DB) database.Driver {
+	t.Helper()
+
+	table := fmt.Sprintf("conformance_%d", conformanceTables.Add(1))
+
+	driver, err := database.Open(dsn, database.Config{TableName: table})
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_, err := db.Exec("DROP TABLE IF EXISTS " + table)
+		require.NoError(t, err)
+	})
+
+	return driver
+}
+
+func TestPostgresConformance(t *testing.T) {
+	dsn := os.Getenv("DSN")
+
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+
+	drivertest.Run(t, func(t *testing.T) database.Driver {
+		return openConformance(t, dsn, db)
+	})
+}
+
+func TestPgxConformance(t *testing.T) {
+	dsn := os.Getenv("DSN")
+
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+
+	drivertest.Run(t, func(t *testing.T) database.Driver {
+		return openConformance(t, pgxDSN(dsn), db)
+	})
+}
+
+func TestMySQLConformance(t *testing.T) {
+	url, db := openMySQL(t)
+
+	drivertest.Run(t, func(t *testing.T) database.Driver {
+		return openConformance(t, url, db)
+	})
+}
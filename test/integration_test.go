@@ -4,6 +4,8 @@
 package test
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"os"
 	"strings"
@@ -11,6 +13,7 @@ import (
 	"time"
 
 	"github.com/XanderKon/sql-migrator-otus/internal/database"
+	"github.com/XanderKon/sql-migrator-otus/internal/database/postgres"
 	"github.com/XanderKon/sql-migrator-otus/pkg/core"
 	"github.com/stretchr/testify/suite"
 )
@@ -21,6 +24,7 @@ type MigratorSuire struct {
 
 	dsn    string
 	driver database.Driver
+	db     *sql.DB
 }
 
 const DefaultTableName = "migrations"
@@ -38,21 +42,27 @@ func (s *MigratorSuire) SetupSuite() {
 	s.migrator = migrator
 
 	// init additional driver connection for checking.
-	driver, err := database.Open(s.dsn, DefaultTableName)
+	driver, err := database.Open(s.dsn, database.Config{TableName: DefaultTableName})
 	s.Require().NoError(err)
 	s.Require().NotNil(driver)
 	s.driver = driver
+
+	// raw connection for cleanup.
+	db, err := sql.Open("postgres", s.dsn)
+	s.Require().NoError(err)
+	s.db = db
 }
 
 // close connection after finishing suite.
 func (s *MigratorSuire) TearDownSuite() {
 	defer s.migrator.Close()
+	defer s.db.Close()
 }
 
 // clear everything after each test.
 func (s *MigratorSuire) TearDownTest() {
 	query := fmt.Sprintf(`DROP TABLE IF EXISTS test;TRUNCATE %s`, DefaultTableName)
-	err := s.driver.Run(strings.NewReader(query))
+	_, err := s.db.Exec(query)
 	s.Require().NoError(err)
 }
 
@@ -61,12 +71,14 @@ func (s *MigratorSuire) TestMigratorUp() {
 	s.NotNil(s.T(), s.migrator)
 
 	// run all up.
-	err := s.migrator.Up()
+	result, err := s.migrator.Up()
 	s.NoError(err)
+	s.Len(result.Migrations, 3)
+	s.Nil(result.Failed())
 	s.checkAppliedListCount(3)
 
 	// run all up again.
-	err = s.migrator.Up()
+	_, err = s.migrator.Up()
 	s.ErrorIs(err, core.ErrAlreadyUpToDate)
 	s.checkAppliedListCount(3)
 }
@@ -76,27 +88,27 @@ func (s *MigratorSuire) TestMigratorDown() {
 	s.NotNil(s.T(), s.migrator)
 
 	// run all up.
-	err := s.migrator.Up()
+	_, err := s.migrator.Up()
 	s.NoError(err)
 	s.checkAppliedListCount(3)
 
 	// run one Down.
-	err = s.migrator.Down()
+	_, err = s.migrator.Down()
 	s.NoError(err)
 	s.checkAppliedListCount(2)
 
 	// one more Down.
-	err = s.migrator.Down()
+	_, err = s.migrator.Down()
 	s.NoError(err)
 	s.checkAppliedListCount(1)
 
 	// one more Down.
-	err = s.migrator.Down()
+	_, err = s.migrator.Down()
 	s.NoError(err)
 	s.checkAppliedListCount(0)
 
 	// final Down.
-	err = s.migrator.Down()
+	_, err = s.migrator.Down()
 	s.ErrorIs(err, core.ErrAlreadyUpToDate)
 	s.checkAppliedListCount(0)
 }
@@ -106,7 +118,7 @@ func (s *MigratorSuire) TestMigratorRedo() {
 	s.NotNil(s.T(), s.migrator)
 
 	// run all up.
-	err := s.migrator.Up()
+	_, err := s.migrator.Up()
 	s.NoError(err)
 	s.checkAppliedListCount(3)
 
@@ -119,8 +131,11 @@ func (s *MigratorSuire) TestMigratorRedo() {
 	time.Sleep(1 * time.Second)
 
 	// run Redo
-	err = s.migrator.Redo()
+	result, err := s.migrator.Redo()
 	s.NoError(err)
+	s.Len(result.Migrations, 2)
+	s.Equal(core.DirectionDown, result.Migrations[0].Direction)
+	s.Equal(core.DirectionUp, result.Migrations[1].Direction)
 	s.checkAppliedListCount(3)
 
 	// get last migration after Redo.
@@ -132,6 +147,19 @@ func (s *MigratorSuire) TestMigratorRedo() {
 	s.Greater(lastMigrationAfterRedo.AppliedAt.Unix(), lastMigration.AppliedAt.Unix())
 }
 
+func (s *MigratorSuire) TestMigratorCanceled() {
+	// ensure that migrator exist.
+	s.NotNil(s.T(), s.migrator)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// nothing should be applied with canceled context.
+	_, err := s.migrator.UpContext(ctx)
+	s.ErrorIs(err, context.Canceled)
+	s.checkAppliedListCount(0)
+}
+
 func (s *MigratorSuire) TestMigratorDbversion() {
 	// ensure that migrator exist.
 	s.NotNil(s.T(), s.migrator)
@@ -142,7 +170,7 @@ func (s *MigratorSuire) TestMigratorDbversion() {
 	s.Equal(version, int64(-1))
 
 	// run all up.
-	err = s.migrator.Up()
+	_, err = s.migrator.Up()
 	s.NoError(err)
 	s.checkAppliedListCount(3)
 
@@ -157,11 +185,175 @@ func (s *MigratorSuire) TestMigratorDbversion() {
 	s.Equal(lastMigration.Version, version)
 }
 
+// failed statement rolls back the whole migration with its version.
+func (s *MigratorSuire) TestDriverRunAtomic() {
+	ctx := context.Background()
+
+	record := &database.ListInfo{Version: 1, Name: "1_broken.sql", State: database.StateApplied, StartedAt: time.Now()}
+
+	// the second statement fails, so neither the table nor the version should be saved.
+	err := s.driver.Run(ctx, &database.Migration{
+		Version: 1,
+		Statements: []database.Statement{
+			{SQL: "CREATE TABLE test (id int);", Line: 2},
+			{SQL: "SELECT * FROM missing_table;", Line: 3},
+		},
+		Record: record,
+	})
+	s.ErrorContains(err, "statement at line 3")
+
+	list, err := s.driver.List(ctx)
+	s.NoError(err)
+	s.Empty(list)
+
+	var exists bool
+	s.NoError(s.db.QueryRow("SELECT to_regclass('test') IS NOT NULL").Scan(&exists))
+	s.False(exists)
+}
+
+func (s *MigratorSuire) TestDriverLock() {
+	ctx := context.Background()
+
+	other, err := database.Open(s.dsn, database.Config{TableName: DefaultTableName})
+	s.Require().NoError(err)
+	defer other.Close()
+
+	s.Require().NoError(s.driver.Lock(ctx))
+
+	// the lock is held by another session.
+	s.ErrorIs(other.Lock(ctx), database.ErrLocked)
+
+	holder, err := other.(database.LockHolder).LockHolder(ctx)
+	s.NoError(err)
+	s.Require().NotNil(holder)
+	s.Positive(holder.PID)
+
+	s.NoError(s.driver.Unlock(ctx))
+
+	// ...and free now.
+	s.NoError(other.Lock(ctx))
+	s.NoError(other.Unlock(ctx))
+}
+
+func (s *MigratorSuire) TestMigratorSchema() {
+	migrator, err := core.New(
+		core.WithDSN(s.dsn),
+		core.WithDir(os.Getenv("DIR")),
+		core.WithSchema("Tenant_1"),
+		core.WithSearchPath(true),
+	)
+	s.Require().NoError(err)
+	defer func() {
+		migrator.Close()
+		_, err := s.db.Exec(`DROP SCHEMA "Tenant_1" CASCADE`)
+		s.NoError(err)
+	}()
+
+	_, err = migrator.Up()
+	s.NoError(err)
+
+	// both migrations table and migrated tables are in the schema.
+	var count int
+	err = s.db.QueryRow(
+		"SELECT count(*) FROM information_schema.tables WHERE table_schema = 'Tenant_1' AND table_name IN ('migrations', 'test')",
+	).Scan(&count)
+	s.NoError(err)
+	s.Equal(2, count)
+}
+
+// the same database through pgx driver.
+func pgxDSN(dsn string) string {
+	return "pgx://" + dsn[strings.Index(dsn, "://")+3:]
+}
+
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Info(msg string, params ...any) {
+	l.messages = append(l.messages, fmt.Sprintf(msg, params...))
+}
+
+func (l *recordingLogger) Warning(msg string, params ...any) {
+	l.messages = append(l.messages, fmt.Sprintf(msg, params...))
+}
+
+func (s *MigratorSuire) TestDriverPgx() {
+	ctx := context.Background()
+	log := &recordingLogger{}
+
+	driver, err := database.Open(pgxDSN(s.dsn), database.Config{TableName: DefaultTableName, Log: log})
+	s.Require().NoError(err)
+	defer driver.Close()
+
+	statements := []database.Statement{
+		{SQL: "CREATE TABLE test (id int, test text);", Line: 2},
+		{SQL: "COPY test (id, test) FROM stdin;", Line: 3, CopyData: []byte("1\tfirst\n2\t\\N\n")},
+		{SQL: "DO $$ BEGIN RAISE NOTICE 'copied %', (SELECT count(*) FROM test); END $$;", Line: 6},
+	}
+
+	// COPY is rolled back with the whole migration
+	err = driver.Run(ctx, &database.Migration{
+		Version:    1,
+		Statements: append(statements, database.Statement{SQL: "SELECT * FROM missing_table;", Line: 7}),
+		Record:     &database.ListInfo{Version: 1, State: database.StateApplied, StartedAt: time.Now()},
+	})
+	s.ErrorContains(err, "statement at line 7")
+
+	var exists bool
+	s.NoError(s.db.QueryRow("SELECT to_regclass('test') IS NOT NULL").Scan(&exists))
+	s.False(exists)
+
+	err = driver.Run(ctx, &database.Migration{
+		Version:    1,
+		Statements: statements,
+		Record:     &database.ListInfo{Version: 1, State: database.StateApplied, StartedAt: time.Now()},
+	})
+	s.NoError(err)
+
+	var count int
+	s.NoError(s.db.QueryRow("SELECT count(*) FROM test WHERE test IS NULL OR test = 'first'").Scan(&count))
+	s.Equal(2, count)
+	s.Contains(log.messages, "NOTICE: copied 2")
+
+	// lib/pq can't do it
+	err = s.driver.Run(ctx, &database.Migration{Version: 2, Statements: statements[1:2]})
+	s.ErrorIs(err, postgres.ErrNoCopy)
+}
+
+func (s *MigratorSuire) TestDriverCancel() {
+	driver, err := database.Open(pgxDSN(s.dsn), database.Config{TableName: DefaultTableName})
+	s.Require().NoError(err)
+	defer driver.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	err = driver.Run(ctx, &database.Migration{
+		Version:    1,
+		Statements: []database.Statement{{SQL: "SELECT pg_sleep(30);", Line: 1}},
+		Record:     &database.ListInfo{Version: 1, State: database.StateApplied, StartedAt: time.Now()},
+	})
+	s.ErrorIs(err, context.DeadlineExceeded)
+	s.Less(time.Since(started), 5*time.Second)
+
+	// nothing is saved
+	s.checkAppliedListCount(0)
+}
+
 // check applied list.
 func (s *MigratorSuire) checkAppliedListCount(expectedCount int) {
 	list, err := s.migrator.FullList()
 	s.NoError(err)
-	s.Equal(len(list), expectedCount)
+
+	applied := 0
+	for _, migr := range list {
+		if migr.State == core.StateApplied {
+			applied++
+		}
+	}
+	s.Equal(applied, expectedCount)
 }
 
 func TestMigrator(t *testing.T) {
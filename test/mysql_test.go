@@ -0,0 +1,95 @@
+//go:build integration
+// +build integration
+
+package test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/XanderKon/sql-migrator-otus/internal/database"
+	"github.com/XanderKon/sql-migrator-otus/internal/database/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+// MySQL URL from MYSQL_DSN and connection to the same database.
+func openMySQL(t *testing.T) (string, *sql.DB) {
+	t.Helper()
+
+	url := os.Getenv("MYSQL_DSN")
+	if url == "" {
+		t.Skip("MYSQL_DSN is not set")
+	}
+
+	dsn, err := mysql.DSN(url)
+	require.NoError(t, err)
+
+	db, err := sql.Open("mysql", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return url, db
+}
+
+func mysqlTableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+
+	var count int
+	err := db.QueryRow(
+		"SELECT count(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", name,
+	).Scan(&count)
+	require.NoError(t, err)
+
+	return count > 0
+}
+
+func TestMySQLPartiallyApplied(t *testing.T) {
+	ctx := context.Background()
+	url, db := openMySQL(t)
+
+	driver := openConformance(t, url, db)
+	t.Cleanup(func() { driver.Close() })
+	require.NoError(t, driver.PrepareTable(ctx))
+
+	t.Cleanup(func() {
+		_, err := db.Exec("DROP TABLE IF EXISTS partial_test")
+		require.NoError(t, err)
+	})
+
+	// CREATE TABLE is committed implicitly, so it isn't rolled back
+	err := driver.Run(ctx, &database.Migration{
+		Version: 1,
+		Statements: []database.Statement{
+			{SQL: "CREATE TABLE partial_test (id int);", Line: 2},
+			{SQL: "SELECT * FROM missing_table;", Line: 3},
+		},
+		Record: &database.ListInfo{Version: 1, State: database.StateApplied},
+	})
+	require.ErrorIs(t, err, mysql.ErrPartiallyApplied)
+	require.ErrorContains(t, err, "statement at line 3")
+	require.True(t, mysqlTableExists(t, db, "partial_test"))
+
+	// ...but the version isn't saved
+	list, err := driver.List(ctx)
+	require.NoError(t, err)
+	require.Empty(t, list)
+
+	// several migrations with DDL are refused before execution
+	err = driver.Run(ctx,
+		&database.Migration{
+			Version:    2,
+			Statements: []database.Statement{{SQL: "CREATE TABLE partial_atomic (id int);", Line: 1}},
+			Record:     &database.ListInfo{Version: 2, State: database.StateApplied},
+		},
+		&database.Migration{
+			Version:    3,
+			Statements: []database.Statement{{SQL: "DROP TABLE partial_test;", Line: 1}},
+			Record:     &database.ListInfo{Version: 3, State: database.StateApplied},
+		},
+	)
+	require.ErrorIs(t, err, mysql.ErrAtomicDDL)
+	require.False(t, mysqlTableExists(t, db, "partial_atomic"))
+	require.True(t, mysqlTableExists(t, db, "partial_test"))
+}